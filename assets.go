@@ -0,0 +1,322 @@
+package main
+
+import (
+	"alchemy/recipe"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// assetDir is the local asset store: images named <sha256><ext>, plus
+// manifestFile listing where each one came from.
+const (
+	assetDir     = "assets"
+	manifestFile = "manifest.json"
+)
+
+// assetBaseURL is what prefetched datasets point their images at: the
+// ASSET_BASE_URL environment variable (e.g. https://api.example.com/assets/)
+// if the frontend is served from elsewhere, otherwise /assets/ on the host
+// the dataset is loaded from. It is never taken from a request, as it ends
+// up in the dataset for good.
+func assetBaseURL() string {
+	if u := os.Getenv("ASSET_BASE_URL"); u != "" {
+		return u
+	}
+	return "/" + assetDir + "/"
+}
+
+// defaultPrefetchWorkers bounds the concurrent downloads of a prefetch.
+const defaultPrefetchWorkers = 8
+
+// prefetchAttempts is how often a failed download is tried, backing off in
+// between, since the CDN answers bursts with errors.
+const prefetchAttempts = 3
+
+var (
+	errPrefetchRunning = errors.New("an image prefetch is already running")
+	assetNamePattern   = regexp.MustCompile(`^[0-9a-f]{64}\.[a-z0-9]+$`)
+)
+
+// PrefetchStatus is the state of a prefetch job as reported by the API.
+type PrefetchStatus struct {
+	JobStatus
+	Workers  int            `json:"workers"`
+	Total    int            `json:"total"` // remote images to download
+	Done     int            `json:"done"`  // downloaded or failed so far
+	Failed   int            `json:"failed"`
+	Manifest *AssetManifest `json:"manifest,omitempty"`
+}
+
+// prefetchJob is one prefetch running in the background.
+type prefetchJob = job[PrefetchStatus, *PrefetchStatus]
+
+// prefetchJobs runs at most one prefetch at a time.
+var prefetchJobs = newJobRegistry[PrefetchStatus]("Prefetch", errPrefetchRunning)
+
+// startPrefetch runs a prefetch in the background. While one runs, it
+// returns the running job and errPrefetchRunning.
+func startPrefetch(images *imageProxy, baseURL string, workers int) (*prefetchJob, error) {
+	job, _, err := prefetchJobs.start(PrefetchStatus{Workers: workers}, nil, func(job *prefetchJob) error {
+		// not tied to any request: a client that disconnects doesn't cancel it
+		manifest, err := prefetchImages(context.Background(), images, baseURL, workers, job)
+		if err != nil {
+			return err
+		}
+		if manifest.Snapshot != nil {
+			if err := reloadGraph(); err != nil {
+				return fmt.Errorf("reloading recipes: %w", err)
+			}
+		}
+		job.update(func(s *PrefetchStatus) { s.Manifest = manifest })
+		return nil
+	})
+	return job, err
+}
+
+// Asset is one image in the asset store.
+type Asset struct {
+	URL         string `json:"url"`  // where it was downloaded from
+	Path        string `json:"path"` // file name in assetDir
+	SHA256      string `json:"sha256"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+}
+
+// FailedAsset is an image the prefetch could not download. The dataset
+// keeps its original URL.
+type FailedAsset struct {
+	URL   string `json:"url"`
+	Error string `json:"error"`
+}
+
+// AssetManifest describes the asset store after a prefetch.
+type AssetManifest struct {
+	GeneratedAt time.Time     `json:"generated_at"`
+	BaseURL     string        `json:"base_url"`
+	Assets      []Asset       `json:"assets"`
+	Failed      []FailedAsset `json:"failed"`
+	Snapshot    *SnapshotMeta `json:"snapshot,omitempty"` // the rewritten dataset
+}
+
+// assetExtensions maps image types to the extension their asset gets, so
+// the file server sends the right Content-Type back.
+var assetExtensions = map[string]string{
+	"image/png":     ".png",
+	"image/jpeg":    ".jpg",
+	"image/gif":     ".gif",
+	"image/webp":    ".webp",
+	"image/svg+xml": ".svg",
+	"image/avif":    ".avif",
+}
+
+func assetName(img cachedImage) string {
+	mediaType, _, _ := strings.Cut(img.ContentType, ";")
+	ext, ok := assetExtensions[strings.TrimSpace(strings.ToLower(mediaType))]
+	if !ok {
+		ext = ".img"
+	}
+	return img.SHA256 + ext
+}
+
+// prefetchImages downloads every remote image of the active dataset into
+// the asset store with a pool of workers, then stores a copy of the dataset
+// that points at baseURL+<asset> instead, as a new active snapshot. Images
+// that fail keep their remote URL. If another dataset is activated while
+// the images download, it is kept and the prefetch fails with
+// errActiveChanged. Progress is reported to job, which may be nil.
+func prefetchImages(ctx context.Context, images *imageProxy, baseURL string, workers int, job *prefetchJob) (*AssetManifest, error) {
+	if workers <= 0 {
+		workers = defaultPrefetchWorkers
+	}
+	if !strings.HasSuffix(baseURL, "/") {
+		baseURL += "/"
+	}
+
+	// the rewritten copy only replaces the version it was made from
+	data, err := os.ReadFile(recipesFile)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+	base := hex.EncodeToString(sum[:])
+	var elements []recipe.ElementData
+	if err := json.Unmarshal(data, &elements); err != nil {
+		return nil, fmt.Errorf("%s: %w", recipesFile, err)
+	}
+
+	// every remote URL once, in a stable order
+	seen := make(map[string]bool)
+	var urls []string
+	for _, e := range elements {
+		if e.ImageURL != "" && !seen[e.ImageURL] && !strings.HasPrefix(e.ImageURL, baseURL) {
+			seen[e.ImageURL] = true
+			urls = append(urls, e.ImageURL)
+		}
+	}
+	sort.Strings(urls)
+	job.update(func(s *PrefetchStatus) { s.Total = len(urls) })
+
+	if err := os.MkdirAll(assetDir, 0o755); err != nil {
+		return nil, err
+	}
+
+	var (
+		mu     sync.Mutex
+		assets = make(map[string]Asset, len(urls))
+		failed = []FailedAsset{}
+		done   int
+	)
+	queue := make(chan string)
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for u := range queue {
+				asset, err := storeAsset(ctx, images, u)
+
+				mu.Lock()
+				if err != nil {
+					failed = append(failed, FailedAsset{URL: u, Error: err.Error()})
+				} else {
+					assets[u] = asset
+				}
+				done++
+				job.update(func(s *PrefetchStatus) { s.Done, s.Failed = done, len(failed) })
+				if done%50 == 0 || done == len(urls) {
+					log.Printf("🖼️ Prefetch: %d/%d images (%d failed)", done, len(urls), len(failed))
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, u := range urls {
+		select {
+		case queue <- u:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	close(queue)
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	manifest := &AssetManifest{GeneratedAt: time.Now().UTC(), BaseURL: baseURL, Assets: []Asset{}, Failed: failed}
+	for _, u := range urls {
+		if asset, ok := assets[u]; ok {
+			manifest.Assets = append(manifest.Assets, asset)
+		}
+	}
+	sort.Slice(manifest.Failed, func(i, j int) bool { return manifest.Failed[i].URL < manifest.Failed[j].URL })
+
+	// the dataset only changes if something was downloaded
+	if len(assets) > 0 {
+		for i := range elements {
+			if asset, ok := assets[elements[i].ImageURL]; ok {
+				elements[i].ImageURL = baseURL + asset.Path
+			}
+		}
+		meta, err := saveDataset(elements, "image prefetch")
+		if err != nil {
+			return nil, err
+		}
+		if err := activateSnapshotOver(meta.ID, base); err != nil {
+			return nil, err
+		}
+		meta.Active = true
+		manifest.Snapshot = &meta
+	}
+
+	data, err = json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := writeFileAtomic(filepath.Join(assetDir, manifestFile), append(data, '\n')); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// storeAsset downloads one image through the image cache and copies it
+// into the asset store.
+func storeAsset(ctx context.Context, images *imageProxy, rawURL string) (Asset, error) {
+	var (
+		img cachedImage
+		err error
+	)
+	for attempt := 1; attempt <= prefetchAttempts; attempt++ {
+		img, err = images.get(rawURL)
+		if err == nil || errors.Is(err, errHostNotAllowed) || errors.Is(err, errAddressNotAllowed) || errors.Is(err, errImageTooLarge) || attempt == prefetchAttempts {
+			break
+		}
+		select {
+		case <-time.After(time.Duration(attempt) * time.Second):
+		case <-ctx.Done():
+			return Asset{}, ctx.Err()
+		}
+	}
+	if err != nil {
+		return Asset{}, err
+	}
+
+	asset := Asset{URL: rawURL, Path: assetName(img), SHA256: img.SHA256, ContentType: img.ContentType, Size: img.Size}
+	path := filepath.Join(assetDir, asset.Path)
+	if _, err := os.Stat(path); err == nil {
+		return asset, nil // same content, already stored
+	}
+	data, err := os.ReadFile(images.blobPath(img.SHA256))
+	if err != nil {
+		return Asset{}, err
+	}
+	return asset, writeFileAtomic(path, data)
+}
+
+// saveDataset stores elements as a new snapshot, without activating it.
+func saveDataset(elements []recipe.ElementData, source string) (SnapshotMeta, error) {
+	data, err := json.MarshalIndent(elements, "", "  ")
+	if err != nil {
+		return SnapshotMeta{}, err
+	}
+	meta := SnapshotMeta{ScrapedAt: time.Now().UTC(), Source: source, Elements: len(elements)}
+	for _, e := range elements {
+		meta.Recipes += len(e.Recipes)
+	}
+	return saveSnapshot(append(data, '\n'), meta)
+}
+
+// serveAsset serves a file of the asset store. Names are content hashes, so
+// a file never changes and can be cached for good.
+func serveAsset(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if !assetNamePattern.MatchString(name) {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	setImageSecurityHeaders(w)
+	http.ServeFile(w, r, filepath.Join(assetDir, name))
+}
+
+// setImageSecurityHeaders keeps an image served from the API origin, SVGs
+// in particular, from running scripts there.
+func setImageSecurityHeaders(w http.ResponseWriter) {
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; sandbox")
+}
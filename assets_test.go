@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// TestPrefetchImages runs a prefetch against a local image server: images
+// end up in the asset store under their content hash, the manifest lists
+// them, and the active dataset points at them, except for the image that
+// could not be downloaded.
+func TestPrefetchImages(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\nnot really a png")
+	gif := []byte("GIF89a, not really a gif")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/air.png", "/dust.png": // same image under two URLs
+			w.Header().Set("Content-Type", "image/png")
+			w.Write(png)
+		case "/fire.gif":
+			w.Header().Set("Content-Type", "image/gif")
+			w.Write(gif)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	t.Chdir(t.TempDir())
+	t.Setenv("TIER_SOURCE", "")
+	writeJSONFile(t, recipesFile, []map[string]any{
+		{"element": "Air", "tier": 0, "image_url": srv.URL + "/air.png"},
+		{"element": "Earth", "tier": 0, "image_url": srv.URL + "/air.png"},
+		{"element": "Fire", "tier": 0, "image_url": srv.URL + "/fire.gif"},
+		{"element": "Water", "tier": 0, "image_url": srv.URL + "/gone.png"},
+		{"element": "Dust", "tier": 1, "image_url": srv.URL + "/dust.png", "recipes": [][]string{{"Air", "Earth"}}},
+	})
+
+	saved := datasets
+	datasets = &datasetRegistry{byName: make(map[string]*dataset)}
+	t.Cleanup(func() { datasets = saved })
+	loadDatasets()
+
+	images := newImageProxy(imageCacheDir)
+	images.client.Transport = srv.Client().Transport // the test server is on loopback
+
+	manifest, err := prefetchImages(context.Background(), images, "/assets/", 2, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pngAsset, gifAsset := assetFile(png, ".png"), assetFile(gif, ".gif")
+	for _, name := range []string{pngAsset, gifAsset} {
+		if _, err := os.Stat(filepath.Join(assetDir, name)); err != nil {
+			t.Errorf("asset %s not stored: %v", name, err)
+		}
+	}
+	if len(manifest.Assets) != 3 {
+		t.Errorf("manifest has %d assets, want 3 (one per downloaded URL): %+v", len(manifest.Assets), manifest.Assets)
+	}
+	if len(manifest.Failed) != 1 || manifest.Failed[0].URL != srv.URL+"/gone.png" {
+		t.Errorf("failed = %+v, want only %s/gone.png", manifest.Failed, srv.URL)
+	}
+	if manifest.Snapshot == nil {
+		t.Error("manifest has no snapshot, the dataset was not rewritten")
+	}
+
+	var onDisk AssetManifest
+	data, err := os.ReadFile(filepath.Join(assetDir, manifestFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, &onDisk); err != nil {
+		t.Fatal(err)
+	}
+	if len(onDisk.Assets) != len(manifest.Assets) || len(onDisk.Failed) != len(manifest.Failed) {
+		t.Errorf("%s differs from the returned manifest", manifestFile)
+	}
+
+	elements, err := readDataset(activeDataset)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"Air":   "/assets/" + pngAsset,
+		"Earth": "/assets/" + pngAsset,
+		"Fire":  "/assets/" + gifAsset,
+		"Water": srv.URL + "/gone.png", // failed, keeps its URL
+		"Dust":  "/assets/" + pngAsset,
+	}
+	for _, e := range elements {
+		if e.ImageURL != want[e.Element] {
+			t.Errorf("%s: image_url = %q, want %q", e.Element, e.ImageURL, want[e.Element])
+		}
+	}
+}
+
+// TestPrefetchImagesKeepsNewerDataset activates another dataset while the
+// images download: the prefetch must fail rather than roll it back.
+func TestPrefetchImagesKeepsNewerDataset(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\nnot really a png")
+	newer := []byte(`[{"element": "Air", "tier": 0}]` + "\n")
+	var once sync.Once
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// a scrape finishing mid-prefetch
+		once.Do(func() { os.WriteFile(recipesFile, newer, 0o644) })
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(png)
+	}))
+	defer srv.Close()
+
+	t.Chdir(t.TempDir())
+	t.Setenv("TIER_SOURCE", "")
+	writeJSONFile(t, recipesFile, []map[string]any{
+		{"element": "Air", "tier": 0, "image_url": srv.URL + "/air.png"},
+		{"element": "Earth", "tier": 0, "image_url": srv.URL + "/earth.png"},
+	})
+
+	saved := datasets
+	datasets = &datasetRegistry{byName: make(map[string]*dataset)}
+	t.Cleanup(func() { datasets = saved })
+	loadDatasets()
+
+	images := newImageProxy(imageCacheDir)
+	images.client.Transport = srv.Client().Transport // the test server is on loopback
+
+	if _, err := prefetchImages(context.Background(), images, "/assets/", 2, nil); !errors.Is(err, errActiveChanged) {
+		t.Fatalf("err = %v, want %v", err, errActiveChanged)
+	}
+	data, err := os.ReadFile(recipesFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, newer) {
+		t.Errorf("%s was replaced after the newer dataset was activated:\n%s", recipesFile, data)
+	}
+}
+
+func assetFile(data []byte, ext string) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]) + ext
+}
+
+func writeJSONFile(t *testing.T, path string, v any) {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"alchemy/recipe"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// commands are the subcommands of the binary, e.g. "go run . scrape".
+// Without a subcommand the API server is started.
+var commands = map[string]func(args []string) error{
+	"scrape":   scrapeCommand,
+	"diff":     diffCommand,
+	"prefetch": prefetchCommand,
+}
+
+// runCommand runs the subcommand named by args[0] and returns the exit code.
+func runCommand(args []string) int {
+	cmd, ok := commands[args[0]]
+	if !ok {
+		names := make([]string, 0, len(commands))
+		for name := range commands {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		fmt.Fprintf(os.Stderr, "unknown command %q (available: %v)\n", args[0], names)
+		return 2
+	}
+	if err := cmd(args[1:]); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		fmt.Fprintf(os.Stderr, "%s: %v\n", args[0], err)
+		return 1
+	}
+	return 0
+}
+
+// scrapeCommand scrapes the elements page into a new snapshot, online or
+// from a saved HTML copy with --from-file.
+func scrapeCommand(args []string) error {
+	fs := flag.NewFlagSet("scrape", flag.ContinueOnError)
+	fromFile := fs.String("from-file", "", "parse this saved HTML page instead of fetching the wiki")
+	activate := fs.Bool("activate", true, "make the new snapshot the active dataset")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	// the scrape is validated with the default dataset's tier source
+	loadDatasets()
+	_, err := mainScrap(*fromFile, *activate, nil)
+	return err
+}
+
+// diffCommand prints what changed between two datasets. Each one is a
+// snapshot ID, "active" or the path of a recipes file.
+func diffCommand(args []string) error {
+	fs := flag.NewFlagSet("diff", flag.ContinueOnError)
+	asJSON := fs.Bool("json", false, "print the diff as JSON")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: diff [--json] <from> <to>")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return errors.New("need exactly two datasets")
+	}
+
+	from, err := loadDatasetArg(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	to, err := loadDatasetArg(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+
+	diff := recipe.Diff(from, to)
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(diff)
+	}
+	return diff.WriteText(os.Stdout)
+}
+
+// loadDatasetArg reads a dataset named on the command line: a snapshot ID,
+// "active", or otherwise a file path.
+func loadDatasetArg(arg string) ([]recipe.ElementData, error) {
+	if arg == activeDataset || snapshotIDPattern.MatchString(arg) {
+		return readDataset(arg)
+	}
+	return recipe.LoadElements(arg)
+}
+
+// prefetchCommand downloads every image of the active dataset into the
+// asset store and points the dataset at it.
+func prefetchCommand(args []string) error {
+	fs := flag.NewFlagSet("prefetch", flag.ContinueOnError)
+	workers := fs.Int("workers", defaultPrefetchWorkers, "concurrent downloads")
+	baseURL := fs.String("base-url", assetBaseURL(), "URL the server's assets are reachable at, e.g. https://api.example.com/assets/")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	// the image proxy only fetches from hosts of the loaded datasets
+	loadDatasets()
+	manifest, err := prefetchImages(context.Background(), newImageProxy(imageCacheDir), *baseURL, *workers, nil)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("✅ %d images stored in %s/, %d failed\n", len(manifest.Assets), assetDir, len(manifest.Failed))
+	for _, f := range manifest.Failed {
+		fmt.Printf("  ❌ %s: %s\n", f.URL, f.Error)
+	}
+	if manifest.Snapshot != nil {
+		fmt.Printf("Dataset rewritten as snapshot %s\n", manifest.Snapshot.ID)
+	}
+	return nil
+}
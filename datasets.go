@@ -0,0 +1,484 @@
+package main
+
+import (
+	"alchemy/recipe"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// defaultDataset is the Little Alchemy 2 dataset kept in recipesFile. It is
+// the one the scraper, snapshots and image prefetch work on, and the one
+// used when a request names no dataset.
+const defaultDataset = "little-alchemy-2"
+
+// registryFile lists the other datasets, as a JSON array of DatasetConfig.
+// It is optional. An entry named defaultDataset only keeps the tier source
+// the default dataset was switched to at runtime.
+const registryFile = "datasets.json"
+
+// datasetDir holds the datasets uploaded through the API, as <name>.json.
+const datasetDir = "datasets"
+
+// Uploads are open to anyone, so they are capped: maxUploadedDatasets in
+// total, replacing one doesn't count, of at most maxDatasetUpload bytes each.
+const (
+	maxUploadedDatasets = 20
+	maxDatasetUpload    = 4 << 20
+)
+
+var (
+	errUnknownDataset   = errors.New("unknown dataset")
+	datasetNamePattern  = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,62}$`)
+	errInvalidDatasetID = errors.New("dataset names are 1-63 lowercase letters, digits and dashes")
+	errDatasetExists    = errors.New("dataset already exists")
+	errDefaultDataset   = errors.New("the default dataset can only be changed by scraping")
+	errTooManyDatasets  = fmt.Errorf("there are already %d uploaded datasets", maxUploadedDatasets)
+)
+
+// DatasetConfig describes one alchemy game the server can search: where its
+// elements are, which elements players start with, and where the tiers
+// behind the tier rule come from.
+type DatasetConfig struct {
+	Name   string            `json:"name"`
+	Title  string            `json:"title,omitempty"`
+	File   string            `json:"file,omitempty"`
+	Basics []string          `json:"basics,omitempty"`
+	Tiers  recipe.TierSource `json:"tiers"`
+
+	// Uploaded marks datasets stored through POST /api/datasets, whose image
+	// hosts are not trusted
+	Uploaded bool `json:"uploaded,omitempty"`
+}
+
+// dataset is a registered dataset with its current graph. Handlers Load the
+// graph once per request, so a reload that happens mid-search never mixes
+// two versions.
+type dataset struct {
+	// mu serializes reloads and tier switches, so the graph, the tier
+	// source and registryFile always agree
+	mu sync.Mutex
+
+	config DatasetConfig
+	tiers  atomic.Value // recipe.TierSource, switchable at runtime
+	graph  atomic.Pointer[recipe.RecipeGraph]
+}
+
+func newDataset(config DatasetConfig) *dataset {
+	d := &dataset{config: config}
+	d.tiers.Store(config.Tiers)
+	return d
+}
+
+// TierSource returns the tier source the dataset's searches use.
+func (d *dataset) TierSource() recipe.TierSource {
+	return d.tiers.Load().(recipe.TierSource)
+}
+
+// SetTierSource switches the tier source, reloads the dataset and records
+// the switch in registryFile, so it survives a restart. Nothing changes if
+// any of it fails.
+func (d *dataset) SetTierSource(source recipe.TierSource) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	g, err := d.build(source)
+	if err != nil {
+		return err
+	}
+	if err := datasets.saveTierSource(d.config.Name, source); err != nil {
+		return fmt.Errorf("saving the tier source: %w", err)
+	}
+	d.tiers.Store(source)
+	d.graph.Store(g)
+	datasets.generation.Add(1)
+	return nil
+}
+
+// Elements reads the dataset file as stored, before tiers are applied.
+func (d *dataset) Elements() ([]recipe.ElementData, error) {
+	elements, err := recipe.LoadElements(d.config.File)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", recipe.ErrDataUnavailable, err)
+	}
+	return elements, nil
+}
+
+// reload rebuilds the graph from the dataset file and swaps it in.
+func (d *dataset) reload() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	g, err := d.build(d.TierSource())
+	if err != nil {
+		return err
+	}
+	d.graph.Store(g)
+	datasets.generation.Add(1)
+	return nil
+}
+
+// build reads the dataset file into a graph with the given tier source.
+func (d *dataset) build(source recipe.TierSource) (*recipe.RecipeGraph, error) {
+	elements, err := d.Elements()
+	if err != nil {
+		return nil, err
+	}
+	return d.graphOf(elements, source), nil
+}
+
+func (d *dataset) graphOf(elements []recipe.ElementData, source recipe.TierSource) *recipe.RecipeGraph {
+	elements = recipe.ApplyTiers(elements, d.config.Basics, source)
+	return recipe.NewRecipeGraph(elements, d.config.Basics...)
+}
+
+// defaultTierSource returns the tier source of the default dataset, or
+// TierScraped if the datasets are not loaded.
+func defaultTierSource() recipe.TierSource {
+	d, err := datasets.get(defaultDataset)
+	if err != nil {
+		return recipe.TierScraped
+	}
+	return d.TierSource()
+}
+
+// datasets is the registry of every dataset the server knows.
+var datasets = &datasetRegistry{byName: make(map[string]*dataset)}
+
+type datasetRegistry struct {
+	mu     sync.RWMutex
+	byName map[string]*dataset
+
+	// storeMu serializes uploads and tier switches, which rewrite
+	// registryFile. It is taken after dataset.mu, never before.
+	storeMu sync.Mutex
+
+	// generation changes whenever a dataset is reloaded, so caches built
+	// from the graphs know when to rebuild
+	generation atomic.Int64
+}
+
+// loadDatasets registers the default dataset and those in registryFile, and
+// loads them all. A dataset that fails to load is still registered, and
+// reports data_unavailable until it is fixed.
+func loadDatasets() {
+	tiers := recipe.TierScraped
+	if t := os.Getenv("TIER_SOURCE"); t != "" {
+		source, err := recipe.ParseTierSource(t)
+		if err != nil {
+			log.Fatalf("TIER_SOURCE: %v", err)
+		}
+		tiers = source
+	}
+	configs := []DatasetConfig{{
+		Name:   defaultDataset,
+		Title:  "Little Alchemy 2",
+		File:   recipesFile,
+		Basics: recipe.DefaultBasicElements,
+		Tiers:  tiers,
+	}}
+
+	extra, err := readRegistry()
+	if err != nil {
+		log.Printf("Failed to read %s: %v", registryFile, err)
+	}
+	for _, config := range extra {
+		if config.Name != defaultDataset {
+			configs = append(configs, config)
+			continue
+		}
+		// a tier source switched at runtime wins over TIER_SOURCE
+		if source, err := recipe.ParseTierSource(string(config.Tiers)); err == nil {
+			configs[0].Tiers = source
+		} else {
+			log.Printf("Ignoring the %s entry of %s: %v", defaultDataset, registryFile, err)
+		}
+	}
+
+	for _, config := range configs {
+		if err := datasets.register(config); err != nil {
+			log.Printf("Skipping dataset %q: %v", config.Name, err)
+			continue
+		}
+		if err := datasets.byName[config.Name].reload(); err != nil {
+			log.Printf("Failed to load dataset %s from %s: %v", config.Name, config.File, err)
+		}
+	}
+}
+
+// readRegistry reads the datasets listed in registryFile.
+func readRegistry() ([]DatasetConfig, error) {
+	data, err := os.ReadFile(registryFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var configs []DatasetConfig
+	if err := json.Unmarshal(data, &configs); err != nil {
+		return nil, err
+	}
+	return configs, nil
+}
+
+// writeRegistry replaces registryFile. The caller holds storeMu.
+func writeRegistry(configs []DatasetConfig) error {
+	if configs == nil {
+		configs = []DatasetConfig{}
+	}
+	data, err := json.MarshalIndent(configs, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(registryFile, append(data, '\n'))
+}
+
+// saveTierSource records the tier source of a dataset in registryFile. The
+// default dataset gets an entry of its own the first time.
+func (r *datasetRegistry) saveTierSource(name string, source recipe.TierSource) error {
+	r.storeMu.Lock()
+	defer r.storeMu.Unlock()
+
+	configs, err := readRegistry()
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", registryFile, err)
+	}
+	i := slices.IndexFunc(configs, func(c DatasetConfig) bool { return c.Name == name })
+	switch {
+	case i >= 0:
+		configs[i].Tiers = source
+	case name == defaultDataset:
+		configs = append(configs, DatasetConfig{Name: defaultDataset, Tiers: source})
+	default:
+		return fmt.Errorf("%s is not listed in %s", name, registryFile)
+	}
+	return writeRegistry(configs)
+}
+
+// checkConfig fills in the defaults of a dataset config and rejects the
+// ones that cannot work.
+func checkConfig(config *DatasetConfig) error {
+	if !datasetNamePattern.MatchString(config.Name) {
+		return errInvalidDatasetID
+	}
+	if config.File == "" {
+		return errors.New("no file")
+	}
+	if len(config.Basics) == 0 {
+		config.Basics = recipe.DefaultBasicElements
+	}
+	if config.Tiers == "" {
+		config.Tiers = recipe.TierScraped
+	}
+	_, err := recipe.ParseTierSource(string(config.Tiers))
+	return err
+}
+
+func (r *datasetRegistry) register(config DatasetConfig) error {
+	if err := checkConfig(&config); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.byName[config.Name]; ok {
+		return fmt.Errorf("dataset %s is already registered", config.Name)
+	}
+	r.byName[config.Name] = newDataset(config)
+	return nil
+}
+
+// store saves an uploaded dataset to datasetDir and registers it in
+// registryFile, replacing the uploaded dataset of the same name if replace
+// is set. The file is written under a temporary name and only renamed into
+// place once the dataset is loaded and registered, so a failed upload leaves
+// the old one in place, on disk and in the server.
+func (r *datasetRegistry) store(config DatasetConfig, elements []recipe.ElementData, replace bool) (*dataset, error) {
+	config.File = filepath.Join(datasetDir, config.Name+".json")
+	config.Uploaded = true
+	if err := checkConfig(&config); err != nil {
+		return nil, err
+	}
+	if config.Name == defaultDataset {
+		return nil, errDefaultDataset
+	}
+
+	r.storeMu.Lock()
+	defer r.storeMu.Unlock()
+	if existing, err := r.get(config.Name); err == nil {
+		if !replace {
+			return nil, fmt.Errorf("%w: %s", errDatasetExists, config.Name)
+		}
+		// datasets set up in registryFile belong to the operator
+		if !existing.config.Uploaded {
+			return nil, fmt.Errorf("%w: %s (only uploaded datasets can be replaced)", errDatasetExists, config.Name)
+		}
+	} else if r.uploaded() >= maxUploadedDatasets {
+		return nil, errTooManyDatasets
+	}
+
+	data, err := json.MarshalIndent(elements, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(datasetDir, 0o755); err != nil {
+		return nil, err
+	}
+	staged := config.File + ".upload"
+	if err := writeFileAtomic(staged, append(data, '\n')); err != nil {
+		return nil, err
+	}
+	defer os.Remove(staged) // gone already if it was renamed
+
+	d := newDataset(config)
+	d.graph.Store(d.graphOf(elements, config.Tiers))
+
+	previous, err := readRegistry()
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", registryFile, err)
+	}
+	configs := slices.DeleteFunc(slices.Clone(previous), func(c DatasetConfig) bool { return c.Name == config.Name })
+	configs = append(configs, config)
+	if err := writeRegistry(configs); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(staged, config.File); err != nil {
+		if restoreErr := writeRegistry(previous); restoreErr != nil {
+			log.Printf("Failed to restore %s: %v", registryFile, restoreErr)
+		}
+		return nil, err
+	}
+
+	r.mu.Lock()
+	r.byName[config.Name] = d
+	r.mu.Unlock()
+	r.generation.Add(1)
+	return d, nil
+}
+
+// uploaded counts the datasets stored through the API.
+func (r *datasetRegistry) uploaded() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	n := 0
+	for _, d := range r.byName {
+		if d.config.Uploaded {
+			n++
+		}
+	}
+	return n
+}
+
+// get returns a registered dataset.
+func (r *datasetRegistry) get(name string) (*dataset, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	d, ok := r.byName[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", errUnknownDataset, name)
+	}
+	return d, nil
+}
+
+// all returns every registered dataset, sorted by name.
+func (r *datasetRegistry) all() []*dataset {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	list := make([]*dataset, 0, len(r.byName))
+	for _, d := range r.byName {
+		list = append(list, d)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].config.Name < list[j].config.Name })
+	return list
+}
+
+// reloadGraph reloads the default dataset after recipesFile changed.
+func reloadGraph() error {
+	d, err := datasets.get(defaultDataset)
+	if err != nil {
+		return err
+	}
+	return d.reload()
+}
+
+// datasetFor returns the dataset named by the dataset query parameter, the
+// default one if there is none. On failure it writes the error response
+// itself and returns false.
+func datasetFor(w http.ResponseWriter, r *http.Request) (*dataset, bool) {
+	name := r.URL.Query().Get("dataset")
+	if name == "" {
+		name = defaultDataset
+	}
+	d, err := datasets.get(name)
+	if err != nil {
+		writeErrorCode(w, http.StatusNotFound, "unknown_dataset", err.Error())
+		return nil, false
+	}
+	return d, true
+}
+
+// defaultOnly is for the endpoints that only exist for the default dataset:
+// scraping, snapshots, diffs and image prefetch. Naming any other dataset is
+// a 400, rather than silently working on the default one. On failure it
+// writes the error response itself and returns false.
+func defaultOnly(w http.ResponseWriter, r *http.Request) bool {
+	if name := r.URL.Query().Get("dataset"); name != "" && name != defaultDataset {
+		writeErrorCode(w, http.StatusBadRequest, "dataset_not_supported",
+			fmt.Sprintf("%s only works on the %s dataset, not %s", r.URL.Path, defaultDataset, name))
+		return false
+	}
+	return true
+}
+
+// graphFor is datasetFor for handlers that only need the current graph.
+func graphFor(w http.ResponseWriter, r *http.Request) (*recipe.RecipeGraph, bool) {
+	d, ok := datasetFor(w, r)
+	if !ok {
+		return nil, false
+	}
+	g := d.graph.Load()
+	if g == nil {
+		writeRecipeError(w, recipe.ErrDataUnavailable)
+		return nil, false
+	}
+	return g, true
+}
+
+// DatasetInfo is a dataset as listed by /api/datasets. It leaves out the
+// config's file, a path on the server.
+type DatasetInfo struct {
+	Name     string            `json:"name"`
+	Title    string            `json:"title,omitempty"`
+	Basics   []string          `json:"basics,omitempty"`
+	Tiers    recipe.TierSource `json:"tiers"`
+	Uploaded bool              `json:"uploaded,omitempty"`
+	Default  bool              `json:"default"`
+	Loaded   bool              `json:"loaded"`
+	Elements int               `json:"elements"`
+}
+
+func (d *dataset) Info() DatasetInfo {
+	info := DatasetInfo{
+		Name:     d.config.Name,
+		Title:    d.config.Title,
+		Basics:   d.config.Basics,
+		Tiers:    d.TierSource(),
+		Uploaded: d.config.Uploaded,
+		Default:  d.config.Name == defaultDataset,
+	}
+	if g := d.graph.Load(); g != nil {
+		info.Loaded = true
+		info.Elements = len(g.Elements())
+	}
+	return info
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"alchemy/recipe"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestDatasetInfoHidesFile(t *testing.T) {
+	d := newDataset(DatasetConfig{Name: "mine", File: "datasets/mine.json", Tiers: recipe.TierComputed, Uploaded: true})
+	data, err := json.Marshal(d.Info())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "datasets/mine.json") {
+		t.Errorf("/api/datasets shows the server path: %s", data)
+	}
+	want := `{"name":"mine","tiers":"computed","uploaded":true,"default":false,"loaded":false,"elements":0}`
+	if string(data) != want {
+		t.Errorf("Info() = %s, want %s", data, want)
+	}
+}
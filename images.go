@@ -0,0 +1,284 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	neturl "net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// imageCacheDir holds the image cache: blobs/<sha256> with the image bytes,
+// shared by every URL with the same content, and urls/<sha256 of URL>.json
+// with what is known about each URL.
+const imageCacheDir = "image-cache"
+
+// maxImageSize caps an image fetched from upstream.
+const maxImageSize = 5 << 20
+
+// defaultImageTimeout bounds an upstream image fetch, unless overridden with
+// the IMAGE_FETCH_TIMEOUT environment variable (e.g. "5s").
+const defaultImageTimeout = 10 * time.Second
+
+var (
+	errHostNotAllowed    = errors.New("image host is not referenced by the dataset")
+	errAddressNotAllowed = errors.New("image host is not on the public internet")
+	errImageTooLarge     = fmt.Errorf("image is larger than %d bytes", maxImageSize)
+)
+
+// nonPublicPrefixes are the ranges publicOnly refuses on top of the ones
+// netip.Addr knows about: "this network" and carrier-grade NAT.
+var nonPublicPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+}
+
+// publicOnly is the net.Dialer Control of the image client. It refuses to
+// connect to loopback, private and link-local addresses, so no dataset, and
+// no DNS name resolving there, can point the proxy at the server itself or
+// the network it runs in.
+func publicOnly(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	ip = ip.Unmap()
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsUnspecified() || ip.IsMulticast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() {
+		return fmt.Errorf("%w: %s", errAddressNotAllowed, ip)
+	}
+	for _, prefix := range nonPublicPrefixes {
+		if prefix.Contains(ip) {
+			return fmt.Errorf("%w: %s", errAddressNotAllowed, ip)
+		}
+	}
+	return nil
+}
+
+// cachedImage is the cache entry of one image URL.
+type cachedImage struct {
+	URL          string    `json:"url"`
+	SHA256       string    `json:"sha256"`
+	ContentType  string    `json:"content_type"`
+	LastModified string    `json:"last_modified,omitempty"` // as sent by upstream
+	Size         int64     `json:"size"`
+	FetchedAt    time.Time `json:"fetched_at"`
+}
+
+// imageProxy fetches dataset images on behalf of the frontend and keeps
+// them on disk, so every image is downloaded once.
+type imageProxy struct {
+	dir    string
+	client *http.Client
+
+	mu        sync.Mutex
+	hostsFrom int64 // datasets.generation the hosts were built from
+	hosts     map[string]bool
+}
+
+func newImageProxy(dir string) *imageProxy {
+	timeout := defaultImageTimeout
+	if t := os.Getenv("IMAGE_FETCH_TIMEOUT"); t != "" {
+		if d, err := time.ParseDuration(t); err == nil && d > 0 {
+			timeout = d
+		} else {
+			log.Printf("Ignoring invalid IMAGE_FETCH_TIMEOUT %q", t)
+		}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil // publicOnly must see the image host, not a proxy
+	transport.DialContext = (&net.Dialer{Timeout: timeout, Control: publicOnly}).DialContext
+
+	p := &imageProxy{dir: dir}
+	p.client = &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		// a redirect must not lead the proxy anywhere the dataset doesn't
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 5 {
+				return errors.New("too many redirects")
+			}
+			if !p.allowed(req.URL) {
+				return errHostNotAllowed
+			}
+			return nil
+		},
+	}
+	return p
+}
+
+// allowedHosts returns the hosts of every image URL in the datasets the
+// operator set up. Uploaded datasets are left out: anyone can upload one, so
+// its URLs must not open the proxy to new hosts. The list is rebuilt only
+// when a dataset changes.
+func (p *imageProxy) allowedHosts() map[string]bool {
+	generation := datasets.generation.Load()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if generation == p.hostsFrom && p.hosts != nil {
+		return p.hosts
+	}
+
+	hosts := make(map[string]bool)
+	for _, d := range datasets.all() {
+		g := d.graph.Load()
+		if g == nil || d.config.Uploaded {
+			continue
+		}
+		for _, e := range g.Elements() {
+			if u, err := neturl.Parse(e.ImageURL); err == nil && u.Host != "" {
+				hosts[strings.ToLower(u.Hostname())] = true
+			}
+		}
+	}
+	p.hostsFrom, p.hosts = generation, hosts
+	return hosts
+}
+
+func (p *imageProxy) allowed(u *neturl.URL) bool {
+	if u.Scheme != "https" && u.Scheme != "http" {
+		return false
+	}
+	return p.allowedHosts()[strings.ToLower(u.Hostname())]
+}
+
+func (p *imageProxy) blobPath(sum string) string {
+	return filepath.Join(p.dir, "blobs", sum)
+}
+
+func (p *imageProxy) entryPath(rawURL string) string {
+	sum := sha256.Sum256([]byte(rawURL))
+	return filepath.Join(p.dir, "urls", hex.EncodeToString(sum[:])+".json")
+}
+
+// lookup returns the cache entry of rawURL, if its image is on disk.
+func (p *imageProxy) lookup(rawURL string) (cachedImage, bool) {
+	data, err := os.ReadFile(p.entryPath(rawURL))
+	if err != nil {
+		return cachedImage{}, false
+	}
+	var img cachedImage
+	if err := json.Unmarshal(data, &img); err != nil || img.URL != rawURL {
+		return cachedImage{}, false
+	}
+	if _, err := os.Stat(p.blobPath(img.SHA256)); err != nil {
+		return cachedImage{}, false
+	}
+	return img, true
+}
+
+// get returns the image at rawURL from the cache, fetching it first if
+// needed. Cached images are served without checking the host, so they keep
+// working offline and after the dataset moves to local assets.
+func (p *imageProxy) get(rawURL string) (cachedImage, error) {
+	if img, ok := p.lookup(rawURL); ok {
+		return img, nil
+	}
+
+	u, err := neturl.Parse(rawURL)
+	if err != nil {
+		return cachedImage{}, err
+	}
+	if !p.allowed(u) {
+		return cachedImage{}, errHostNotAllowed
+	}
+	return p.fetch(rawURL)
+}
+
+// fetch downloads rawURL into the cache.
+func (p *imageProxy) fetch(rawURL string) (cachedImage, error) {
+	resp, err := p.client.Get(rawURL)
+	if err != nil {
+		return cachedImage{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return cachedImage{}, fmt.Errorf("upstream returned %s", resp.Status)
+	}
+	contentType := resp.Header.Get("Content-Type")
+	if !strings.HasPrefix(contentType, "image/") {
+		return cachedImage{}, fmt.Errorf("upstream sent %q, not an image", contentType)
+	}
+	if resp.ContentLength > maxImageSize {
+		return cachedImage{}, errImageTooLarge
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxImageSize+1))
+	if err != nil {
+		return cachedImage{}, err
+	}
+	if len(data) > maxImageSize {
+		return cachedImage{}, errImageTooLarge
+	}
+
+	sum := sha256.Sum256(data)
+	img := cachedImage{
+		URL:          rawURL,
+		SHA256:       hex.EncodeToString(sum[:]),
+		ContentType:  contentType,
+		LastModified: resp.Header.Get("Last-Modified"),
+		Size:         int64(len(data)),
+		FetchedAt:    time.Now().UTC(),
+	}
+	entry, err := json.Marshal(img)
+	if err != nil {
+		return cachedImage{}, err
+	}
+
+	for _, dir := range []string{"blobs", "urls"} {
+		if err := os.MkdirAll(filepath.Join(p.dir, dir), 0o755); err != nil {
+			return cachedImage{}, err
+		}
+	}
+	// blob first, so an entry never points at a missing blob
+	if _, err := os.Stat(p.blobPath(img.SHA256)); err != nil {
+		if err := writeFileAtomic(p.blobPath(img.SHA256), data); err != nil {
+			return cachedImage{}, err
+		}
+	}
+	if err := writeFileAtomic(p.entryPath(rawURL), entry); err != nil {
+		return cachedImage{}, err
+	}
+	return img, nil
+}
+
+// serve writes a cached image, answering conditional requests from its
+// ETag (the content hash) and Last-Modified.
+func (p *imageProxy) serve(w http.ResponseWriter, r *http.Request, img cachedImage) {
+	data, err := os.ReadFile(p.blobPath(img.SHA256))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Reading cached image failed")
+		return
+	}
+
+	modTime := img.FetchedAt
+	if t, err := http.ParseTime(img.LastModified); err == nil {
+		modTime = t
+	}
+	w.Header().Set("Content-Type", img.ContentType)
+	w.Header().Set("ETag", `"`+img.SHA256+`"`)
+	// the content behind an ETag never changes
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	setImageSecurityHeaders(w)
+	http.ServeContent(w, r, "", modTime, bytes.NewReader(data))
+}
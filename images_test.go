@@ -0,0 +1,151 @@
+package main
+
+import (
+	"alchemy/recipe"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	neturl "net/url"
+	"sync/atomic"
+	"testing"
+)
+
+// useDatasets replaces the dataset registry for one test with an operator
+// dataset and an uploaded one, whose only element has the given image.
+func useDatasets(t *testing.T, operatorImage, uploadedImage string) {
+	t.Helper()
+	saved := datasets
+	datasets = &datasetRegistry{byName: make(map[string]*dataset)}
+	t.Cleanup(func() { datasets = saved })
+
+	for _, d := range []struct {
+		config DatasetConfig
+		image  string
+	}{
+		{DatasetConfig{Name: defaultDataset, Tiers: recipe.TierScraped}, operatorImage},
+		{DatasetConfig{Name: "mine", Tiers: recipe.TierScraped, Uploaded: true}, uploadedImage},
+	} {
+		ds := newDataset(d.config)
+		ds.graph.Store(recipe.NewRecipeGraph([]recipe.ElementData{{Element: "Air", ImageURL: d.image}}))
+		datasets.byName[d.config.Name] = ds
+	}
+	datasets.generation.Add(1)
+}
+
+func TestImageProxyAllowlist(t *testing.T) {
+	useDatasets(t, "https://static.example.com/air.png", "https://uploader.example.net/air.png")
+	p := newImageProxy(t.TempDir())
+
+	tests := []struct {
+		url  string
+		want bool
+	}{
+		{"https://static.example.com/other.png", true},
+		{"http://STATIC.example.com/air.png", true},
+		{"https://uploader.example.net/air.png", false}, // only in an uploaded dataset
+		{"https://elsewhere.example.org/air.png", false},
+		{"ftp://static.example.com/air.png", false},
+		{"https://static.example.com.evil.test/air.png", false},
+	}
+	for _, tt := range tests {
+		u, err := neturl.Parse(tt.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := p.allowed(u); got != tt.want {
+			t.Errorf("allowed(%s) = %v, want %v", tt.url, got, tt.want)
+		}
+	}
+
+	if _, err := p.get("https://elsewhere.example.org/air.png"); !errors.Is(err, errHostNotAllowed) {
+		t.Errorf("get of a host outside the allowlist: err = %v, want %v", err, errHostNotAllowed)
+	}
+}
+
+func TestPublicOnly(t *testing.T) {
+	tests := []struct {
+		address string
+		allowed bool
+	}{
+		{"93.184.216.34:443", true},
+		{"[2606:4700:4700::1111]:443", true},
+		{"127.0.0.1:80", false},
+		{"[::1]:80", false},
+		{"[::ffff:127.0.0.1]:80", false},
+		{"10.1.2.3:80", false},
+		{"172.16.0.1:80", false},
+		{"192.168.1.1:80", false},
+		{"[fd00::1]:80", false},
+		{"169.254.169.254:80", false}, // cloud metadata
+		{"[fe80::1]:80", false},
+		{"0.0.0.0:80", false},
+		{"100.64.0.1:80", false},
+	}
+	for _, tt := range tests {
+		err := publicOnly("tcp", tt.address, nil)
+		if tt.allowed && err != nil {
+			t.Errorf("%s refused: %v", tt.address, err)
+		}
+		if !tt.allowed && !errors.Is(err, errAddressNotAllowed) {
+			t.Errorf("%s: err = %v, want %v", tt.address, err, errAddressNotAllowed)
+		}
+	}
+}
+
+// TestImageProxyRefusesLoopback checks that the dial check holds even for a
+// host the dataset allows.
+func TestImageProxyRefusesLoopback(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("the proxy reached a loopback server")
+	}))
+	defer srv.Close()
+	useDatasets(t, srv.URL+"/air.png", "")
+
+	p := newImageProxy(t.TempDir())
+	if _, err := p.get(srv.URL + "/air.png"); !errors.Is(err, errAddressNotAllowed) {
+		t.Errorf("err = %v, want %v", err, errAddressNotAllowed)
+	}
+}
+
+func TestImageProxyServesFromCache(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\nnot really a png")
+	var fetches atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(png)
+	}))
+	defer srv.Close()
+	useDatasets(t, srv.URL+"/air.png", "")
+
+	dir := t.TempDir()
+	p := newImageProxy(dir)
+	p.client.Transport = srv.Client().Transport // the test server is on loopback
+	first, err := p.get(srv.URL + "/air.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a new proxy over the same cache, after the host left the dataset
+	useDatasets(t, "https://static.example.com/air.png", "")
+	p = newImageProxy(dir)
+	again, err := p.get(srv.URL + "/air.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := fetches.Load(); n != 1 {
+		t.Errorf("upstream fetched %d times, want 1", n)
+	}
+	if again != first {
+		t.Errorf("cached entry %+v, want %+v", again, first)
+	}
+
+	rec := httptest.NewRecorder()
+	p.serve(rec, httptest.NewRequest(http.MethodGet, "/api/image", nil), again)
+	if rec.Code != http.StatusOK || rec.Body.String() != string(png) {
+		t.Errorf("served %d %q, want the cached image", rec.Code, rec.Body.String())
+	}
+	if etag := rec.Header().Get("ETag"); etag != `"`+first.SHA256+`"` {
+		t.Errorf("ETag = %s, want the content hash", etag)
+	}
+}
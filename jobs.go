@@ -0,0 +1,267 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ScrapePhase is the step a scrape job is at.
+type ScrapePhase string
+
+const (
+	PhaseFetching       ScrapePhase = "fetching"
+	PhaseParsingTiers   ScrapePhase = "parsing_tiers"
+	PhaseParsingImages  ScrapePhase = "parsing_images"
+	PhaseParsingRecipes ScrapePhase = "parsing_recipes"
+	PhaseValidating     ScrapePhase = "validating"
+	PhaseWriting        ScrapePhase = "writing"
+	PhaseDone           ScrapePhase = "done"
+)
+
+// States of a background job.
+const (
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+)
+
+// keepJobs is how many finished jobs of each kind stay queryable.
+const keepJobs = 20
+
+// JobStatus is the part of a job's status every kind of job reports.
+type JobStatus struct {
+	ID         string     `json:"id"`
+	State      string     `json:"state"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Error      string     `json:"error,omitempty"`
+}
+
+func (s *JobStatus) common() *JobStatus {
+	return s
+}
+
+// jobStatus is the status type S of a kind of job, which embeds JobStatus.
+type jobStatus[S any] interface {
+	*S
+	common() *JobStatus
+}
+
+// job is one job running in the background, reporting a status S. A nil
+// *job records nothing, so the scraper and the image prefetch can report
+// progress unconditionally, as the CLI runs them without a job.
+type job[S any, P jobStatus[S]] struct {
+	mu     sync.Mutex
+	status S
+	err    error
+	done   chan struct{}
+}
+
+// update changes the job's status under its lock.
+func (j *job[S, P]) update(change func(s *S)) {
+	if j == nil {
+		return
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	change(&j.status)
+}
+
+func (j *job[S, P]) finish(err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	status := P(&j.status).common()
+	now := time.Now().UTC()
+	status.FinishedAt = &now
+	if err != nil {
+		status.State = JobFailed
+		status.Error = err.Error()
+		j.err = err
+	} else {
+		status.State = JobSucceeded
+	}
+	close(j.done)
+}
+
+// Status returns a copy of the job's current status.
+func (j *job[S, P]) Status() S {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.status
+}
+
+// Err returns the error the job failed with, once it is done.
+func (j *job[S, P]) Err() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.err
+}
+
+// jobRegistry runs at most one job of a kind at a time and remembers the
+// last few, so a job outlives the request that started it.
+type jobRegistry[S any, P jobStatus[S]] struct {
+	name       string // for logs, e.g. "Scrape"
+	errRunning error
+
+	mu      sync.Mutex
+	running *job[S, P]
+	jobs    map[string]*job[S, P]
+	order   []string // IDs, oldest first
+}
+
+func newJobRegistry[S any, P jobStatus[S]](name string, errRunning error) *jobRegistry[S, P] {
+	return &jobRegistry[S, P]{name: name, errRunning: errRunning, jobs: make(map[string]*job[S, P])}
+}
+
+// start runs work in the background as a new job with the given status,
+// whose common part it fills in. While a job runs, it returns the running
+// job instead: joined, if join accepts its status, and otherwise with an
+// error wrapping errRunning. join may be nil.
+func (r *jobRegistry[S, P]) start(status S, join func(running S) bool, work func(j *job[S, P]) error) (j *job[S, P], joined bool, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if running := r.running; running != nil {
+		status := running.Status()
+		if join != nil && join(status) {
+			return running, true, nil
+		}
+		return running, false, fmt.Errorf("%w (job %s)", r.errRunning, P(&status).common().ID)
+	}
+
+	common := P(&status).common()
+	common.ID = newJobID()
+	common.State = JobRunning
+	common.StartedAt = time.Now().UTC()
+	j = &job[S, P]{status: status, done: make(chan struct{})}
+
+	r.running = j
+	r.jobs[common.ID] = j
+	r.order = append(r.order, common.ID)
+	for len(r.order) > keepJobs {
+		delete(r.jobs, r.order[0])
+		r.order = r.order[1:]
+	}
+
+	go r.run(j, common.ID, work)
+	return j, false, nil
+}
+
+func (r *jobRegistry[S, P]) run(j *job[S, P], id string, work func(j *job[S, P]) error) {
+	var err error
+	defer func() {
+		// a bug in the job must fail it, not take the server down
+		if p := recover(); p != nil {
+			err = fmt.Errorf("%s panicked: %v", strings.ToLower(r.name), p)
+		}
+		if err != nil {
+			log.Printf("%s job %s failed: %v", r.name, id, err)
+		}
+
+		r.mu.Lock()
+		r.running = nil
+		r.mu.Unlock()
+		j.finish(err)
+	}()
+
+	err = work(j)
+}
+
+// get returns a job that is running or recently finished.
+func (r *jobRegistry[S, P]) get(id string) (*job[S, P], bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	j, ok := r.jobs[id]
+	return j, ok
+}
+
+// ScrapeCounts is what a scrape job has found so far.
+type ScrapeCounts struct {
+	TierHeadings int `json:"tier_headings"`
+	Tiered       int `json:"tiered_elements"`
+	Images       int `json:"images"`
+	Elements     int `json:"elements"`
+	Recipes      int `json:"recipes"`
+}
+
+// ScrapeStatus is the state of a scrape job as reported by the API. Phase
+// stays at the step that failed when the job fails.
+type ScrapeStatus struct {
+	JobStatus
+	Phase      ScrapePhase    `json:"phase"`
+	Source     string         `json:"source"`
+	Activate   bool           `json:"activate"`
+	Counts     ScrapeCounts   `json:"counts"`
+	Validation map[string]int `json:"validation,omitempty"` // issues by code
+	Snapshot   *SnapshotMeta  `json:"snapshot,omitempty"`
+}
+
+// scrapeJob is one scrape running in the background.
+type scrapeJob = job[ScrapeStatus, *ScrapeStatus]
+
+func setPhase(job *scrapeJob, phase ScrapePhase) {
+	job.update(func(s *ScrapeStatus) { s.Phase = phase })
+}
+
+var errScrapeRunning = errors.New("another scrape is running")
+
+// scrapeJobs runs at most one scrape at a time.
+var scrapeJobs = newJobRegistry[ScrapeStatus]("Scrape", errScrapeRunning)
+
+// startScrape runs a scrape in the background. page is an uploaded copy of
+// the elements page, or nil to fetch the live one. A request for the same
+// scrape as the running job joins it, and joined is true; any other request
+// fails with errScrapeRunning while a scrape runs.
+func startScrape(page []byte, activate bool) (job *scrapeJob, joined bool, err error) {
+	source, phase := url, PhaseFetching
+	if page != nil {
+		source, phase = "upload", PhaseParsingTiers
+	}
+	join := func(running ScrapeStatus) bool {
+		// uploads are never joined: the running job parses a different page
+		return page == nil && running.Source == source && running.Activate == activate
+	}
+
+	status := ScrapeStatus{Phase: phase, Source: source, Activate: activate}
+	return scrapeJobs.start(status, join, func(job *scrapeJob) error {
+		var (
+			meta SnapshotMeta
+			err  error
+		)
+		if page != nil {
+			meta, err = scrapeReader(bytes.NewReader(page), "upload", activate, job)
+		} else {
+			meta, err = mainScrap("", activate, job)
+		}
+		if err != nil {
+			return err
+		}
+		if activate {
+			if err := reloadGraph(); err != nil {
+				return fmt.Errorf("reloading recipes: %w", err)
+			}
+		}
+		job.update(func(s *ScrapeStatus) {
+			s.Phase = PhaseDone
+			s.Snapshot = &meta
+		})
+		return nil
+	})
+}
+
+func newJobID() string {
+	b := make([]byte, 8)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
@@ -2,13 +2,24 @@ package main
 
 import (
 	"alchemy/recipe"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"os"
 	"strconv"
+	"strings"
+	"time"
 )
 
+const recipesFile = "recipes.json"
+
+// maxUploadSize caps an HTML page or dataset uploaded to the API.
+const maxUploadSize = 32 << 20
+
 // func isElementInRecipes(target string, elements []recipe.ElementData) bool {
 // 	for _, element := range elements {
 // 		if element.Element == target {
@@ -166,253 +177,762 @@ import (
 // }
 
 func main() {
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(os.Args[1:]))
+	}
+
+	loadDatasets()
+
 	mux := http.NewServeMux()
 
 	// 🔍 SEARCH HANDLER
 	mux.HandleFunc("/api/search", func(w http.ResponseWriter, r *http.Request) {
+		run, ok := runSearch(w, r)
+		if !ok {
+			return
+		}
+
+		result := recipe.NewSearchResult(run.g, run.algorithm, run.res)
+		if seed := run.query.Seed; seed != nil {
+			// durasi beda tiap run, jadi dihilangkan supaya output seeded
+			// selalu byte-identical
+			result.Seed = seed
+			result.Duration = ""
+		}
+		if run.trace != nil {
+			result.Trace = run.trace.Events()
+			result.TraceTruncated = run.trace.Truncated()
+		}
+		writeJSON(w, result)
+	})
+
+	// 🖼️ EXPORT HANDLER
+	mux.HandleFunc("/api/search/export", func(w http.ResponseWriter, r *http.Request) {
+		format := r.URL.Query().Get("format")
+		export, ok := exportFormats[format]
+		if !ok {
+			writeError(w, http.StatusBadRequest, "Invalid format (must be dot, svg, mermaid or markdown)")
+			return
+		}
+
+		run, ok := runSearch(w, r)
+		if !ok {
+			return
+		}
+
+		trees := recipe.NewSearchResult(run.g, run.algorithm, run.res).Trees
+		w.Header().Set("Content-Type", export.contentType)
+		if err := export.write(w, run.g, trees); err != nil {
+			log.Printf("export %s: %v", format, err)
+		}
+	})
+
+	// 🔢 COUNT HANDLER
+	mux.HandleFunc("/api/count", func(w http.ResponseWriter, r *http.Request) {
 		target := r.URL.Query().Get("target")
 		if target == "" {
-			http.Error(w, "Missing target", http.StatusBadRequest)
+			writeError(w, http.StatusBadRequest, "Missing target")
 			return
 		}
 
-		algorithm := r.URL.Query().Get("algorithm")
-		if algorithm == "" {
-			algorithm = "dfs"
+		g, ok := graphFor(w, r)
+		if !ok {
+			return
+		}
+		target, err := g.Resolve(target)
+		if err != nil {
+			writeRecipeError(w, err)
+			return
 		}
 
-		maxPaths := 1
-		if mp := r.URL.Query().Get("maxPaths"); mp != "" {
-			if val, err := strconv.Atoi(mp); err == nil && val > 0 {
-				maxPaths = val
-			} else {
-				http.Error(w, "Invalid maxPaths", http.StatusBadRequest)
+		inventory, err := parseInventory(r, g)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		// counts can exceed 2^53, so they are sent as strings
+		type recipeCount struct {
+			Ingredients [2]string `json:"ingredients"`
+			Count       string    `json:"count"`
+		}
+
+		counter := recipe.NewRecipeCounter(g, inventory...)
+		result := struct {
+			Element string        `json:"element"`
+			Count   string        `json:"count"`
+			Recipes []recipeCount `json:"recipes"`
+		}{
+			Element: target,
+			Count:   counter.Count(target).String(),
+			Recipes: []recipeCount{},
+		}
+		for _, rc := range counter.Breakdown(target) {
+			result.Recipes = append(result.Recipes, recipeCount{Ingredients: rc.Ingredients, Count: rc.Count.String()})
+		}
+
+		writeJSON(w, result)
+	})
+
+	// 🔁 USES HANDLER
+	mux.HandleFunc("/api/uses", func(w http.ResponseWriter, r *http.Request) {
+		element := r.URL.Query().Get("element")
+		if element == "" {
+			writeError(w, http.StatusBadRequest, "Missing element")
+			return
+		}
+
+		g, ok := graphFor(w, r)
+		if !ok {
+			return
+		}
+		element, err := g.Resolve(element)
+		if err != nil {
+			writeRecipeError(w, err)
+			return
+		}
+
+		uses := g.Uses(element)
+		if uses == nil {
+			uses = []recipe.Use{}
+		}
+		writeJSON(w, struct {
+			Element string       `json:"element"`
+			Uses    []recipe.Use `json:"uses"`
+		}{element, uses})
+	})
+
+	// 🧲 SCRAPING HANDLER
+	mux.HandleFunc("/api/scrape", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeError(w, http.StatusMethodNotAllowed, "Only POST allowed")
+			return
+		}
+		if !defaultOnly(w, r) {
+			return
+		}
+
+		// activate=false menyimpan snapshot tanpa langsung dipakai
+		activate := true
+		if a := r.URL.Query().Get("activate"); a != "" {
+			val, err := strconv.ParseBool(a)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, "Invalid activate parameter")
 				return
 			}
+			activate = val
 		}
 
-		startingElements := []string{"Air", "Earth", "Fire", "Water"}
+		// body HTML (mis. halaman wiki yang disimpan) diparse langsung,
+		// tanpa body, scraper mengambil halaman live
+		var page []byte
+		if r.ContentLength != 0 && strings.HasPrefix(r.Header.Get("Content-Type"), "text/html") {
+			var err error
+			page, err = io.ReadAll(http.MaxBytesReader(w, r.Body, maxUploadSize))
+			if err != nil {
+				writeError(w, http.StatusBadRequest, "Reading page failed: "+err.Error())
+				return
+			}
+		}
 
-		var result recipe.SearchResult
+		job, joined, err := startScrape(page, activate)
+		if errors.Is(err, errScrapeRunning) {
+			writeErrorCode(w, http.StatusConflict, "scrape_running", err.Error())
+			return
+		}
+		if joined {
+			log.Printf("Scrape request joined running job %s", job.Status().ID)
+		} else {
+			log.Printf("Scraping triggered via API, job %s", job.Status().ID)
+		}
 
-		bidi := r.URL.Query().Get("bidi")
-		elements, err := recipe.LoadElements("recipes.json")
-		if err != nil {
-			http.Error(w, "Failed to load recipe elements", http.StatusInternalServerError)
-			return
-		}
-		recipeMap, tierMap, basicElements := recipe.PrepareElementMaps(elements)
-
-		switch algorithm {
-		case "dfs":
-			if maxPaths > 1 {
-				paths, visited, duration := recipe.FindMultipleRecipesDFSConcurrent("recipes.json", target, startingElements, maxPaths)
-				if len(paths) == 0 {
-					http.Error(w, "No path found", http.StatusNotFound)
-					return
-				}
-
-				var converted [][]string
-				var stepsList []map[string][]string
-				for _, p := range paths {
-					var pathSteps []string
-					stepMap := make(map[string][]string)
-					for _, s := range p.Steps {
-						pathSteps = append(pathSteps, s.Result)
-						stepMap[s.Result] = []string{s.Ingredients[0], s.Ingredients[1]}
-					}
-					converted = append(converted, pathSteps)
-					stepsList = append(stepsList, stepMap)
-				}
-
-				result = recipe.SearchResult{
-					Paths:        converted,
-					Steps:        stepsList,
-					NodesVisited: visited,
-					Duration:     duration.String(),
-					Algorithm:    "dfs",
-				}
-			} else {
-				path, visited, duration := recipe.FindSingleRecipeDFS("recipes.json", target, startingElements)
-				if path == nil {
-					http.Error(w, "No path found", http.StatusNotFound)
-					return
-				}
-				stepMap := make(map[string][]string)
-				var pathList []string
-				for _, s := range path.Steps {
-					stepMap[s.Result] = []string{s.Ingredients[0], s.Ingredients[1]}
-					pathList = append(pathList, s.Result)
-				}
-				result = recipe.SearchResult{
-					Paths:        [][]string{pathList},
-					Steps:        []map[string][]string{stepMap},
-					NodesVisited: visited,
-					Duration:     duration.String(),
-					Algorithm:    "dfs",
-				}
+		// wait=true menunggu job selesai, seperti sebelum scraping async
+		if wait, _ := strconv.ParseBool(r.URL.Query().Get("wait")); wait {
+			select {
+			case <-job.done:
+			case <-r.Context().Done():
+				return
 			}
-		case "bfs":
-			if maxPaths > 1 {
-				paths, visited, duration := recipe.FindMultipleRecipesBFSConcurrent("recipes.json", target, startingElements, maxPaths)
-				if len(paths) == 0 {
-					http.Error(w, "No path found", http.StatusNotFound)
-					return
-				}
-
-				var converted [][]string
-				var stepsList []map[string][]string
-				for _, p := range paths {
-					var pathSteps []string
-					stepMap := make(map[string][]string)
-					for _, s := range p.Steps {
-						pathSteps = append(pathSteps, s.Result)
-						stepMap[s.Result] = []string{s.Ingredients[0], s.Ingredients[1]}
-					}
-					converted = append(converted, pathSteps)
-					stepsList = append(stepsList, stepMap)
-				}
-
-				result = recipe.SearchResult{
-					Paths:        converted,
-					Steps:        stepsList,
-					NodesVisited: visited,
-					Duration:     duration.String(),
-					Algorithm:    "bfs",
-				}
-			} else {
-				path, visited, duration := recipe.FindSingleRecipeBFS("recipes.json", target, startingElements)
-				if path == nil {
-					http.Error(w, "No path found", http.StatusNotFound)
-					return
-				}
-				stepMap := make(map[string][]string)
-				var pathList []string
-				for _, s := range path.Steps {
-					stepMap[s.Result] = []string{s.Ingredients[0], s.Ingredients[1]}
-					pathList = append(pathList, s.Result)
-				}
-				result = recipe.SearchResult{
-					Paths:        [][]string{pathList},
-					Steps:        []map[string][]string{stepMap},
-					NodesVisited: visited,
-					Duration:     duration.String(),
-					Algorithm:    "bfs",
-				}
+			status := http.StatusOK
+			if err := job.Err(); errors.Is(err, recipe.ErrInvalidDataset) {
+				status = http.StatusUnprocessableEntity
+			} else if err != nil {
+				status = http.StatusInternalServerError
 			}
-		case "bidirectional":
-			if bidi != "bfs" && bidi != "dfs" {
-				http.Error(w, "Invalid bidi parameter (must be bfs or dfs)", http.StatusBadRequest)
+			writeJSONStatus(w, status, job.Status())
+			return
+		}
+
+		w.Header().Set("Location", "/api/scrape/"+job.Status().ID)
+		writeJSONStatus(w, http.StatusAccepted, job.Status())
+	})
+
+	mux.HandleFunc("/api/scrape/{id}", func(w http.ResponseWriter, r *http.Request) {
+		job, ok := scrapeJobs.get(r.PathValue("id"))
+		if !ok {
+			writeErrorCode(w, http.StatusNotFound, "job_not_found", "Scrape job not found: "+r.PathValue("id"))
+			return
+		}
+		writeJSON(w, job.Status())
+	})
+
+	// 🗂️ SNAPSHOT HANDLERS
+	mux.HandleFunc("/api/dataset/snapshots", func(w http.ResponseWriter, r *http.Request) {
+		if !defaultOnly(w, r) {
+			return
+		}
+
+		snapshots, err := listSnapshots()
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "Listing snapshots failed: "+err.Error())
+			return
+		}
+		writeJSON(w, snapshots)
+	})
+
+	mux.HandleFunc("/api/dataset/snapshots/{id}/activate", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeError(w, http.StatusMethodNotAllowed, "Only POST allowed")
+			return
+		}
+		if !defaultOnly(w, r) {
+			return
+		}
+
+		id := r.PathValue("id")
+		err := activateSnapshot(id)
+		if errors.Is(err, errSnapshotNotFound) {
+			writeErrorCode(w, http.StatusNotFound, "snapshot_not_found", err.Error())
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "Activating snapshot failed: "+err.Error())
+			return
+		}
+		if err := reloadGraph(); err != nil {
+			writeError(w, http.StatusInternalServerError, "Reloading recipes failed: "+err.Error())
+			return
+		}
+
+		meta, err := findSnapshot(id)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		writeJSON(w, meta)
+	})
+
+	// 🔀 DATASET DIFF HANDLER
+	// from/to berupa ID snapshot atau "active"
+	mux.HandleFunc("/api/dataset/diff", func(w http.ResponseWriter, r *http.Request) {
+		if !defaultOnly(w, r) {
+			return
+		}
+
+		from, to := r.URL.Query().Get("from"), r.URL.Query().Get("to")
+		if from == "" || to == "" {
+			writeError(w, http.StatusBadRequest, "Missing from or to")
+			return
+		}
+
+		var pair [2][]recipe.ElementData
+		for i, ref := range []string{from, to} {
+			elements, err := readDataset(ref)
+			if errors.Is(err, errSnapshotNotFound) {
+				writeErrorCode(w, http.StatusNotFound, "snapshot_not_found", err.Error())
+				return
+			}
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, "Reading dataset failed: "+err.Error())
 				return
 			}
+			pair[i] = elements
+		}
 
-			if maxPaths > 1 {
-				paths, steps, totalNodes, duration := recipe.FindMultipleRecipesBi(target, recipeMap, basicElements, bidi, maxPaths, tierMap)
-				if len(paths) == 0 {
-					http.Error(w, "No path found", http.StatusNotFound)
-					return
-				}
-
-				result = recipe.SearchResult{
-					Paths:        paths,
-					Steps:        steps,
-					NodesVisited: totalNodes,
-					Duration:     duration.String(),
-					Algorithm:    "bidirectional-" + bidi,
-				}
-			} else {
-				path, step, visited, duration := recipe.FindSingleRecipeBi(target, recipeMap, basicElements, bidi, tierMap)
-				if path == nil {
-					http.Error(w, "No path found", http.StatusNotFound)
-					return
-				}
-
-				result = recipe.SearchResult{
-					Paths:        [][]string{path},
-					Steps:        []map[string][]string{step},
-					NodesVisited: visited,
-					Duration:     duration.String(),
-					Algorithm:    "bidirectional-" + bidi,
-				}
+		writeJSON(w, recipe.Diff(pair[0], pair[1]))
+	})
+
+	// 🪜 TIER SOURCE HANDLER
+	// GET: tier yang dipakai + beda tier scraping vs hasil hitung,
+	// POST ?source=scraped|computed: ganti sumber tier
+	mux.HandleFunc("/api/dataset/tiers", func(w http.ResponseWriter, r *http.Request) {
+		d, ok := datasetFor(w, r)
+		if !ok {
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPost:
+			source, err := recipe.ParseTierSource(r.URL.Query().Get("source"))
+			if err != nil {
+				writeError(w, http.StatusBadRequest, err.Error())
+				return
 			}
+			if err := d.SetTierSource(source); err != nil {
+				writeRecipeError(w, err)
+				return
+			}
+			log.Printf("Tier source of %s switched to %s", d.config.Name, source)
 		default:
-			http.Error(w, "Unknown algorithm", http.StatusBadRequest)
+			writeError(w, http.StatusMethodNotAllowed, "Only GET or POST allowed")
 			return
 		}
 
-		writeJSON(w, result)
+		elements, err := d.Elements()
+		if err != nil {
+			writeRecipeError(w, err)
+			return
+		}
+		writeJSON(w, struct {
+			Source recipe.TierSource `json:"source"`
+			*recipe.TierReport
+		}{d.TierSource(), recipe.CompareTiers(elements, d.config.Basics)})
 	})
 
-	// 🧲 SCRAPING HANDLER
-	mux.HandleFunc("/api/scrape", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodPost {
-			http.Error(w, "Only POST allowed", http.StatusMethodNotAllowed)
+	// ✅ DATASET VALIDATION HANDLER
+	// GET memvalidasi dataset aktif, POST memvalidasi dataset JSON di body
+	// (dengan elemen dasar dari dataset yang dipilih)
+	mux.HandleFunc("/api/dataset/validate", func(w http.ResponseWriter, r *http.Request) {
+		d, ok := datasetFor(w, r)
+		if !ok {
 			return
 		}
 
-		log.Println("Scraping triggered via API...")
-		if err := mainScrap(); err != nil {
-			http.Error(w, "Scraping failed: "+err.Error(), http.StatusInternalServerError)
+		var elements []recipe.ElementData
+		switch r.Method {
+		case http.MethodGet:
+			g := d.graph.Load()
+			if g == nil {
+				writeRecipeError(w, recipe.ErrDataUnavailable)
+				return
+			}
+			elements = g.Elements()
+		case http.MethodPost:
+			if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxUploadSize)).Decode(&elements); err != nil {
+				writeError(w, http.StatusBadRequest, "Invalid dataset JSON: "+err.Error())
+				return
+			}
+		default:
+			writeError(w, http.StatusMethodNotAllowed, "Only GET or POST allowed")
 			return
 		}
 
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("Scraping completed successfully"))
+		writeJSON(w, recipe.Validate(elements, d.config.Basics...))
+	})
+
+	// 📚 DATASETS HANDLER
+	// GET: daftar dataset, POST: upload dataset baru (JSON atau CSV)
+	mux.HandleFunc("/api/datasets", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPost:
+			uploadDataset(w, r)
+			return
+		default:
+			writeError(w, http.StatusMethodNotAllowed, "Only GET or POST allowed")
+			return
+		}
+
+		result := []DatasetInfo{}
+		for _, d := range datasets.all() {
+			result = append(result, d.Info())
+		}
+		writeJSON(w, result)
 	})
 
 	mux.HandleFunc("/api/elements", func(w http.ResponseWriter, r *http.Request) {
-		elements, err := recipe.LoadElements("recipes.json")
-		if err != nil {
-			http.Error(w, "Failed to load elements", http.StatusInternalServerError)
+		g, ok := graphFor(w, r)
+		if !ok {
 			return
 		}
+		elements := g.Elements()
+
+		// filter opsional: ?tier=N dan ?prefix=abc (case-insensitive)
+		tier := -1
+		if t := r.URL.Query().Get("tier"); t != "" {
+			n, err := strconv.Atoi(t)
+			if err != nil || n < 0 {
+				writeError(w, http.StatusBadRequest, "Invalid tier")
+				return
+			}
+			tier = n
+		}
+		prefix := strings.ToLower(r.URL.Query().Get("prefix"))
 
 		type ElementImage struct {
 			Element  string `json:"element"`
 			ImageURL string `json:"image_url"`
+			Tier     int    `json:"tier"`
 		}
 
-		var result []ElementImage
+		result := []ElementImage{}
 		for _, e := range elements {
+			if tier >= 0 && g.TierMap()[e.Element] != tier {
+				continue
+			}
+			if prefix != "" && !strings.HasPrefix(strings.ToLower(e.Element), prefix) {
+				continue
+			}
 			result = append(result, ElementImage{
 				Element:  e.Element,
 				ImageURL: e.ImageURL,
+				Tier:     g.TierMap()[e.Element],
 			})
 		}
 
 		writeJSON(w, result)
 	})
 
+	// 📄 ELEMENT DETAIL HANDLER
+	mux.HandleFunc("/api/elements/{name}", func(w http.ResponseWriter, r *http.Request) {
+		g, ok := graphFor(w, r)
+		if !ok {
+			return
+		}
+
+		name, err := g.Resolve(r.PathValue("name"))
+		if err != nil {
+			writeRecipeError(w, err)
+			return
+		}
+
+		// a configured basic the dataset doesn't list resolves, but has no detail
+		detail, ok := g.Detail(name)
+		if !ok {
+			writeRecipeError(w, &recipe.ElementError{Element: name, Err: recipe.ErrUnknownElement})
+			return
+		}
+		writeJSON(w, detail)
+	})
+
+	// 💡 SUGGEST HANDLER
+	mux.HandleFunc("/api/suggest", func(w http.ResponseWriter, r *http.Request) {
+		limit := 10
+		if l := r.URL.Query().Get("limit"); l != "" {
+			if val, err := strconv.Atoi(l); err == nil && val > 0 {
+				limit = val
+			} else {
+				writeError(w, http.StatusBadRequest, "Invalid limit")
+				return
+			}
+		}
+
+		g, ok := graphFor(w, r)
+		if !ok {
+			return
+		}
+
+		writeJSON(w, g.Suggest(r.URL.Query().Get("q"), limit))
+	})
+
+	// 🖼️ IMAGE PROXY HANDLER
+	// hanya host gambar yang ada di dataset aktif, dan disimpan di cache disk
+	images := newImageProxy(imageCacheDir)
 	mux.HandleFunc("/api/image", func(w http.ResponseWriter, r *http.Request) {
 		url := r.URL.Query().Get("url")
 		if url == "" {
-			http.Error(w, "Missing image URL", http.StatusBadRequest)
+			writeError(w, http.StatusBadRequest, "Missing image URL")
 			return
 		}
 
-		resp, err := http.Get(url)
-		if err != nil || resp.StatusCode != http.StatusOK {
-			http.Error(w, "Failed to fetch image", http.StatusBadGateway)
+		img, err := images.get(url)
+		switch {
+		case errors.Is(err, errHostNotAllowed):
+			writeErrorCode(w, http.StatusForbidden, "host_not_allowed", err.Error())
+			return
+		case errors.Is(err, errAddressNotAllowed):
+			writeErrorCode(w, http.StatusForbidden, "host_not_allowed", errAddressNotAllowed.Error())
+			return
+		case errors.Is(err, errImageTooLarge):
+			writeErrorCode(w, http.StatusBadGateway, "image_too_large", err.Error())
+			return
+		case err != nil:
+			log.Printf("image %s: %v", url, err)
+			writeError(w, http.StatusBadGateway, "Failed to fetch image")
 			return
 		}
-		defer resp.Body.Close()
 
-		w.Header().Set("Content-Type", resp.Header.Get("Content-Type"))
-		io.Copy(w, resp.Body)
+		images.serve(w, r, img)
 	})
 
+	// 📦 IMAGE PREFETCH HANDLER
+	// mengunduh semua gambar dataset ke assets/ lalu dataset diarahkan ke sana
+	mux.HandleFunc("/api/images/prefetch", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeError(w, http.StatusMethodNotAllowed, "Only POST allowed")
+			return
+		}
+		if !defaultOnly(w, r) {
+			return
+		}
+
+		workers := defaultPrefetchWorkers
+		if n := r.URL.Query().Get("workers"); n != "" {
+			val, err := strconv.Atoi(n)
+			if err != nil || val <= 0 || val > 64 {
+				writeError(w, http.StatusBadRequest, "Invalid workers (must be 1 to 64)")
+				return
+			}
+			workers = val
+		}
+		job, err := startPrefetch(images, assetBaseURL(), workers)
+		if errors.Is(err, errPrefetchRunning) {
+			w.Header().Set("Location", "/api/images/prefetch/"+job.Status().ID)
+			writeErrorCode(w, http.StatusConflict, "prefetch_running", err.Error())
+			return
+		}
+		log.Printf("Image prefetch triggered via API, job %s", job.Status().ID)
+
+		// wait=true menunggu sampai semua gambar selesai diunduh
+		if wait, _ := strconv.ParseBool(r.URL.Query().Get("wait")); wait {
+			select {
+			case <-job.done:
+			case <-r.Context().Done():
+				return
+			}
+			status := http.StatusOK
+			if job.Err() != nil {
+				status = http.StatusInternalServerError
+			}
+			writeJSONStatus(w, status, job.Status())
+			return
+		}
+
+		w.Header().Set("Location", "/api/images/prefetch/"+job.Status().ID)
+		writeJSONStatus(w, http.StatusAccepted, job.Status())
+	})
+
+	mux.HandleFunc("/api/images/prefetch/{id}", func(w http.ResponseWriter, r *http.Request) {
+		job, ok := prefetchJobs.get(r.PathValue("id"))
+		if !ok {
+			writeErrorCode(w, http.StatusNotFound, "job_not_found", "Prefetch job not found: "+r.PathValue("id"))
+			return
+		}
+		writeJSON(w, job.Status())
+	})
+
+	mux.HandleFunc("/"+assetDir+"/{name}", serveAsset)
+
 	log.Println("🌐 Server running at http://localhost:8080")
 	log.Fatal(http.ListenAndServe(":8080", withCORS(mux)))
 }
 
+// exportFormats lists the formats served by /api/search/export.
+var exportFormats = map[string]struct {
+	contentType string
+	write       func(io.Writer, *recipe.RecipeGraph, []*recipe.RecipeNode) error
+}{
+	"dot":      {"text/vnd.graphviz; charset=utf-8", recipe.WriteDOT},
+	"svg":      {"image/svg+xml", recipe.WriteSVG},
+	"mermaid":  {"text/plain; charset=utf-8", recipe.WriteMermaid},
+	"markdown": {"text/markdown; charset=utf-8", recipe.WriteMarkdown},
+}
+
+// searchRun is a finished search, as parsed and run by runSearch.
+type searchRun struct {
+	g         *recipe.RecipeGraph
+	algorithm string
+	query     recipe.Query
+	res       recipe.Result
+	trace     *recipe.Trace
+}
+
+// runSearch parses the /api/search parameters and runs the search. On
+// failure it writes the error response itself and returns false.
+func runSearch(w http.ResponseWriter, r *http.Request) (*searchRun, bool) {
+	target := r.URL.Query().Get("target")
+	if target == "" {
+		writeError(w, http.StatusBadRequest, "Missing target")
+		return nil, false
+	}
+
+	algorithm := r.URL.Query().Get("algorithm")
+	if algorithm == "" {
+		algorithm = "dfs"
+	}
+
+	maxPaths := 1
+	if mp := r.URL.Query().Get("maxPaths"); mp != "" {
+		if val, err := strconv.Atoi(mp); err == nil && val > 0 {
+			maxPaths = val
+		} else {
+			writeError(w, http.StatusBadRequest, "Invalid maxPaths")
+			return nil, false
+		}
+	}
+
+	// seed membuat hasil multiple bisa direproduksi
+	var seed *int64
+	if s := r.URL.Query().Get("seed"); s != "" {
+		val, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid seed")
+			return nil, false
+		}
+		seed = &val
+	}
+
+	// timeout bounds the search; whatever was found by then is returned
+	// with complete=false. The search also stops if the client goes away.
+	ctx := r.Context()
+	if t := r.URL.Query().Get("timeout"); t != "" {
+		timeout, err := time.ParseDuration(t)
+		if err != nil || timeout <= 0 {
+			writeError(w, http.StatusBadRequest, "Invalid timeout (use a duration such as 500ms or 5s)")
+			return nil, false
+		}
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	// trace=true merekam langkah-langkah pencarian untuk animasi
+	var trace *recipe.Trace
+	if t := r.URL.Query().Get("trace"); t != "" {
+		enabled, err := strconv.ParseBool(t)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid trace parameter")
+			return nil, false
+		}
+		// multiple searches run their attempts concurrently, so there is
+		// no single ordered trace to return
+		if enabled && maxPaths > 1 {
+			writeErrorCode(w, http.StatusBadRequest, "trace_unavailable", "Trace is only available with maxPaths=1")
+			return nil, false
+		}
+		if enabled {
+			trace = recipe.NewTrace(recipe.DefaultTraceLimit)
+			ctx = recipe.WithTrace(ctx, trace)
+		}
+	}
+
+	// "bidirectional" is split by strategy, e.g. "bidirectional-bfs"
+	name := algorithm
+	if algorithm == "bidirectional" {
+		bidi := r.URL.Query().Get("bidi")
+		if bidi != "bfs" && bidi != "dfs" {
+			writeError(w, http.StatusBadRequest, "Invalid bidi parameter (must be bfs or dfs)")
+			return nil, false
+		}
+		name += "-" + bidi
+	}
+
+	searcher, ok := recipe.Lookup(name)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "Unknown algorithm")
+		return nil, false
+	}
+
+	g, ok := graphFor(w, r)
+	if !ok {
+		return nil, false
+	}
+
+	// nama target boleh beda huruf besar/kecil atau spasi
+	target, err := g.Resolve(target)
+	if err != nil {
+		writeRecipeError(w, err)
+		return nil, false
+	}
+
+	inventory, err := parseInventory(r, g)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return nil, false
+	}
+
+	query := recipe.Query{Target: target, MaxPaths: maxPaths, Inventory: inventory, Seed: seed}
+
+	var res recipe.Result
+	if maxPaths > 1 {
+		res, err = searcher.FindMultiple(ctx, g, query)
+	} else {
+		res, err = searcher.FindSingle(ctx, g, query)
+	}
+	if err != nil {
+		writeRecipeError(w, err)
+		return nil, false
+	}
+
+	return &searchRun{g: g, algorithm: name, query: query, res: res, trace: trace}, true
+}
+
+// parseInventory reads the inventory query parameter, given either as a
+// comma separated list or repeated, and resolves every element name.
+func parseInventory(r *http.Request, g *recipe.RecipeGraph) ([]string, error) {
+	var inventory []string
+	for _, param := range r.URL.Query()["inventory"] {
+		for _, elem := range strings.Split(param, ",") {
+			if elem = strings.TrimSpace(elem); elem == "" {
+				continue
+			}
+			resolved, err := g.Resolve(elem)
+			if err != nil {
+				return nil, fmt.Errorf("inventory: %w", err)
+			}
+			inventory = append(inventory, resolved)
+		}
+	}
+	return inventory, nil
+}
+
+// apiError is the JSON body of every error response.
+type apiError struct {
+	Error       string   `json:"error"`
+	Code        string   `json:"code,omitempty"`
+	Suggestions []string `json:"suggestions,omitempty"`
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeErrorCode(w, status, "", message)
+}
+
+func writeErrorCode(w http.ResponseWriter, status int, code, message string) {
+	writeErrorBody(w, status, apiError{Error: message, Code: code})
+}
+
+func writeErrorBody(w http.ResponseWriter, status int, body apiError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// writeRecipeError maps errors from the recipe package to a status code.
+func writeRecipeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, recipe.ErrUnknownElement):
+		body := apiError{Error: err.Error(), Code: "unknown_element"}
+		var elemErr *recipe.ElementError
+		if errors.As(err, &elemErr) {
+			body.Suggestions = elemErr.Suggestions
+		}
+		writeErrorBody(w, http.StatusNotFound, body)
+	case errors.Is(err, recipe.ErrTargetIsBasic):
+		writeErrorCode(w, http.StatusBadRequest, "target_is_basic", err.Error())
+	case errors.Is(err, recipe.ErrUnreachable):
+		writeErrorCode(w, http.StatusUnprocessableEntity, "unreachable", err.Error())
+	case errors.Is(err, recipe.ErrDataUnavailable):
+		writeErrorCode(w, http.StatusServiceUnavailable, "data_unavailable", err.Error())
+	default:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
 func writeJSON(w http.ResponseWriter, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	err := json.NewEncoder(w).Encode(data)
 	if err != nil {
-		http.Error(w, "Failed to encode JSON", http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, "Failed to encode JSON")
 	}
 }
 
+func writeJSONStatus(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(data)
+}
+
 func withCORS(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
@@ -1,6 +1,7 @@
 package recipe
 
 import (
+	"context"
 	"time"
 )
 
@@ -12,7 +13,28 @@ type BFSNode struct {
 	Defined   map[string][2]string
 }
 
-func findPathBFS(recipes []ElementRecipe, startElements []string, target string) ([]Path, time.Duration, int) {
+func init() {
+	Register("bfs", bfsSearcher{})
+}
+
+type bfsSearcher struct{}
+
+func (bfsSearcher) FindSingle(ctx context.Context, g *RecipeGraph, q Query) (Result, error) {
+	path, visited, duration, err := FindSingleRecipeBFS(ctx, g, q.Target, g.StartingElements(q.Inventory...))
+	res := Result{Complete: ctx.Err() == nil, Stats: SearchStats{NodesVisited: visited, Duration: duration}}
+	if path != nil {
+		res.Paths = []Path{*path}
+	}
+	return res, err
+}
+
+func (bfsSearcher) FindMultiple(ctx context.Context, g *RecipeGraph, q Query) (Result, error) {
+	ctx = untraced(ctx) // see WithTrace
+	paths, visited, duration, err := FindMultipleRecipesBFSConcurrent(ctx, g, q.Target, g.StartingElements(q.Inventory...), q.MaxPaths, q.Seed)
+	return Result{Paths: paths, Complete: ctx.Err() == nil, Stats: SearchStats{NodesVisited: visited, Duration: duration}}, err
+}
+
+func findPathBFS(ctx context.Context, recipes []ElementRecipe, startElements []string, target string) ([]Path, time.Duration, int) {
 	startTime := time.Now()
 
 	// Lookup maps
@@ -47,6 +69,7 @@ func findPathBFS(recipes []ElementRecipe, startElements []string, target string)
 	}
 
 	visitedCounter := make(map[string]bool)
+	trace := traceFrom(ctx)
 
 	queue := []BFSNode{
 		{
@@ -59,6 +82,10 @@ func findPathBFS(recipes []ElementRecipe, startElements []string, target string)
 	}
 
 	for len(queue) > 0 {
+		if ctx.Err() != nil {
+			break
+		}
+
 		curr := queue[0]
 		queue = queue[1:]
 
@@ -75,6 +102,7 @@ func findPathBFS(recipes []ElementRecipe, startElements []string, target string)
 		}
 
 		if allBasic {
+			trace.solution(target, len(queue))
 			reversedSteps := make([]Step, len(curr.Steps))
 			for i, step := range curr.Steps {
 				reversedSteps[len(curr.Steps)-1-i] = step
@@ -85,6 +113,8 @@ func findPathBFS(recipes []ElementRecipe, startElements []string, target string)
 			}}, time.Since(startTime), len(visitedCounter)
 		}
 
+		trace.expand(elemToExpand, "", len(queue))
+
 		if curr.Visited[elemToExpand] {
 			newRemaining := removeElement(curr.Remaining, elemToExpand)
 
@@ -170,6 +200,8 @@ func findPathBFS(recipes []ElementRecipe, startElements []string, target string)
 				StepSet:   newStepSet,
 				Defined:   newDefined, // NEW
 			})
+			trace.generate(a, elemToExpand, []string{a, b}, "", len(queue))
+			trace.generate(b, elemToExpand, []string{a, b}, "", len(queue))
 
 		}
 	}
@@ -2,7 +2,9 @@ package recipe
 
 import (
 	"container/list"
+	"context"
 	"fmt"
+	"sort"
 	"time"
 )
 
@@ -13,6 +15,44 @@ type BiState struct {
 	AvailableElems map[string]bool
 }
 
+func init() {
+	Register("bidirectional-bfs", biSearcher{strategy: "bfs"})
+	Register("bidirectional-dfs", biSearcher{strategy: "dfs"})
+}
+
+// biSearcher adapts the bidirectional searches, which work on element ->
+// ingredients maps, to the Searcher interface.
+type biSearcher struct {
+	strategy string // "bfs" or "dfs"
+}
+
+func (s biSearcher) FindSingle(ctx context.Context, g *RecipeGraph, q Query) (Result, error) {
+	basicElements := g.startingSet(q.Inventory)
+	path, steps, visited, duration, err := FindSingleRecipeBi(ctx, g, q.Target, basicElements, s.strategy)
+	res := Result{Complete: ctx.Err() == nil, Stats: SearchStats{NodesVisited: visited, Duration: duration}}
+	if path != nil {
+		res.Paths = []Path{pathFromSteps(q.Target, steps, basicElements)}
+	}
+	return res, err
+}
+
+func (s biSearcher) FindMultiple(ctx context.Context, g *RecipeGraph, q Query) (Result, error) {
+	basicElements := g.startingSet(q.Inventory)
+	ctx = untraced(ctx) // see WithTrace
+	paths, steps, visited, duration, err := FindMultipleRecipesBi(ctx, g, q.Target, basicElements, s.strategy, q.MaxPaths, q.Seed)
+	res := Result{Complete: ctx.Err() == nil, Stats: SearchStats{NodesVisited: visited, Duration: duration}}
+	// different raw paths can share the same steps, keep each recipe once
+	seen := make(map[string]bool)
+	for i := range paths {
+		p := pathFromSteps(q.Target, steps[i], basicElements)
+		if sig := generateSignature(p); !seen[sig] {
+			seen[sig] = true
+			res.Paths = append(res.Paths, p)
+		}
+	}
+	return res, err
+}
+
 func isValidElement(element string, elements map[string][][]string, tiers map[string]int) bool {
 	// Harus punya info tier
 	if _, hasTier := tiers[element]; !hasTier {
@@ -27,7 +67,7 @@ func isValidElement(element string, elements map[string][][]string, tiers map[st
 	return false
 }
 
-func BiSearchBFS(target string, elements map[string][][]string, basicElements map[string]bool, tiers map[string]int) ([]string, map[string][]string, int, time.Duration) {
+func BiSearchBFS(ctx context.Context, target string, elements map[string][][]string, basicElements map[string]bool, tiers map[string]int) ([]string, map[string][]string, int, time.Duration) {
 	startTime := time.Now()
 	nodesExplored := 0
 
@@ -43,7 +83,10 @@ func BiSearchBFS(target string, elements map[string][][]string, basicElements ma
 	backwardIngredient := make(map[string][]string) // element -> the pair of ingredients it's part of
 	backwardVisited := make(map[string]bool)
 
-	for elem := range basicElements {
+	// map diiterasi urut supaya hasilnya selalu sama
+	results := sortedKeys(elements)
+
+	for _, elem := range sortedKeys(basicElements) {
 		forwardQueue.PushBack(elem)
 		forwardVisited[elem] = true
 		nodesExplored++ // Menambah hitungan untuk setiap node awal
@@ -55,20 +98,34 @@ func BiSearchBFS(target string, elements map[string][][]string, basicElements ma
 
 	meetingPoints := make(map[string]bool)
 
+	trace := traceFrom(ctx)
+	meet := func(elem string) {
+		if !meetingPoints[elem] {
+			meetingPoints[elem] = true
+			trace.meet(elem, forwardQueue.Len()+backwardQueue.Len())
+		}
+	}
+
 	// Alternating BFS
 	for forwardQueue.Len() > 0 && backwardQueue.Len() > 0 {
+		if ctx.Err() != nil {
+			break
+		}
+
 		levelSize := forwardQueue.Len()
 		for i := 0; i < levelSize; i++ {
 			current := forwardQueue.Remove(forwardQueue.Front()).(string)
+			trace.expand(current, TraceForward, forwardQueue.Len())
 			// Node sudah dihitung saat dimasukkan ke queue
 
 			// cek kalo udh ketemu
 			if backwardVisited[current] {
-				meetingPoints[current] = true
+				meet(current)
 			}
 
 			// coba craft dr basic element dan yg udh dipunya
-			for result, recipes := range elements {
+			for _, result := range results {
+				recipes := elements[result]
 				nodesExplored++ // Menambah hitungan untuk setiap hasil yang diperiksa
 
 				if forwardVisited[result] {
@@ -102,14 +159,15 @@ func BiSearchBFS(target string, elements map[string][][]string, basicElements ma
 						forwardParent[result] = current
 						forwardRecipe[result] = []string{ing1, ing2}
 						forwardQueue.PushBack(result)
+						trace.generate(result, current, []string{ing1, ing2}, TraceForward, forwardQueue.Len())
 						nodesExplored++ // Menambah hitungan untuk node baru yang ditemukan
 
 						if backwardVisited[result] {
-							meetingPoints[result] = true
+							meet(result)
 						}
 
 						if result == target {
-							meetingPoints[result] = true
+							meet(result)
 							break
 						}
 					}
@@ -125,38 +183,36 @@ func BiSearchBFS(target string, elements map[string][][]string, basicElements ma
 				allSteps[elem] = recipe
 			}
 
-			for elem, ingredients := range backwardIngredient {
+			for _, elem := range sortedKeys(backwardIngredient) {
+				ingredients := backwardIngredient[elem]
 				parent := backwardParent[elem]
 				if parent != "" && !basicElements[elem] {
 					allSteps[parent] = ingredients
 				}
 			}
 
-			// reconstruct a path
-			for meetingPoint := range meetingPoints {
-				// kalo meeting point nya dr bw
-				if recipe, ok := backwardIngredient[meetingPoint]; ok && meetingPoint != target {
-					allSteps[meetingPoint] = recipe
-				}
-
-				path := reconstructPath(target, allSteps, basicElements, elements, tiers)
-				if path != nil {
-					return path, allSteps, nodesExplored, time.Since(startTime)
-				}
+			// reconstruct a path. backwardIngredient[m] is the recipe of m's
+			// parent, which is already in allSteps, so it must not be used
+			// as the recipe of the meeting point itself.
+			path := reconstructPath(target, allSteps, basicElements, elements, tiers)
+			if path != nil && stepsReach(target, allSteps, basicElements) {
+				trace.solution(target, forwardQueue.Len()+backwardQueue.Len())
+				return path, allSteps, nodesExplored, time.Since(startTime)
 			}
 		}
 
 		levelSize = backwardQueue.Len()
 		for i := 0; i < levelSize; i++ {
 			current := backwardQueue.Remove(backwardQueue.Front()).(string)
+			trace.expand(current, TraceBackward, backwardQueue.Len())
 			// Node sudah dihitung saat dimasukkan ke queue
 
 			if forwardVisited[current] {
-				meetingPoints[current] = true
+				meet(current)
 			}
 
 			if basicElements[current] {
-				meetingPoints[current] = true
+				meet(current)
 				continue
 			}
 
@@ -186,12 +242,13 @@ func BiSearchBFS(target string, elements map[string][][]string, basicElements ma
 					if !backwardVisited[ing] {
 						backwardVisited[ing] = true
 						backwardQueue.PushBack(ing)
+						trace.generate(ing, current, []string{ing1, ing2}, TraceBackward, backwardQueue.Len())
 						nodesExplored++ // Menambah hitungan untuk ingredien baru yang ditemukan
 						backwardParent[ing] = current
 						backwardIngredient[ing] = []string{ing1, ing2} // simpan resep dari elemen saat ini
 
 						if forwardVisited[ing] {
-							meetingPoints[ing] = true
+							meet(ing)
 						}
 					}
 				}
@@ -207,23 +264,18 @@ func BiSearchBFS(target string, elements map[string][][]string, basicElements ma
 			}
 
 			// add all backward recipes
-			for elem, ingredients := range backwardIngredient {
+			for _, elem := range sortedKeys(backwardIngredient) {
+				ingredients := backwardIngredient[elem]
 				parent := backwardParent[elem]
 				if parent != "" && !basicElements[elem] {
 					allSteps[parent] = ingredients
 				}
 			}
 
-			for meetingPoint := range meetingPoints {
-				// kalo meeting point nya dr bw
-				if recipe, ok := backwardIngredient[meetingPoint]; ok && meetingPoint != target {
-					allSteps[meetingPoint] = recipe
-				}
-
-				path := reconstructPath(target, allSteps, basicElements, elements, tiers)
-				if path != nil {
-					return path, allSteps, nodesExplored, time.Since(startTime)
-				}
+			path := reconstructPath(target, allSteps, basicElements, elements, tiers)
+			if path != nil && stepsReach(target, allSteps, basicElements) {
+				trace.solution(target, forwardQueue.Len()+backwardQueue.Len())
+				return path, allSteps, nodesExplored, time.Since(startTime)
 			}
 		}
 	}
@@ -232,7 +284,7 @@ func BiSearchBFS(target string, elements map[string][][]string, basicElements ma
 	return nil, nil, nodesExplored, time.Since(startTime)
 }
 
-func BiSearchDFS(target string, elements map[string][][]string, basicElements map[string]bool, tiers map[string]int) ([]string, map[string][]string, int, time.Duration) {
+func BiSearchDFS(ctx context.Context, target string, elements map[string][][]string, basicElements map[string]bool, tiers map[string]int) ([]string, map[string][]string, int, time.Duration) {
 	startTime := time.Now()
 
 	type SearchState struct {
@@ -246,9 +298,13 @@ func BiSearchDFS(target string, elements map[string][][]string, basicElements ma
 	forwardVisited := make(map[string]map[string][]string)
 	backwardVisited := make(map[string]map[string][]string)
 	nodesExplored := 0
+	trace := traceFrom(ctx)
+
+	// map diiterasi urut supaya hasilnya selalu sama
+	results := sortedKeys(elements)
 
 	// Inisialisasi forward stack
-	for element := range basicElements {
+	for _, element := range sortedKeys(basicElements) {
 		available := make(map[string]bool)
 		for e := range basicElements {
 			available[e] = true
@@ -293,6 +349,10 @@ func BiSearchDFS(target string, elements map[string][][]string, basicElements ma
 
 	// Alternating bidirectional DFS
 	for forwardStack.Len() > 0 || backwardStack.Len() > 0 {
+		if ctx.Err() != nil {
+			break
+		}
+
 		// forward dfs step
 		if forwardStack.Len() > 0 {
 			current := forwardStack.Remove(forwardStack.Back()).(SearchState)
@@ -307,8 +367,10 @@ func BiSearchDFS(target string, elements map[string][][]string, basicElements ma
 				stepsCopy[k] = append([]string{}, v...)
 			}
 			forwardVisited[current.Element] = stepsCopy
+			trace.expand(current.Element, TraceForward, forwardStack.Len())
 
 			if backwardSteps, found := backwardVisited[current.Element]; found {
+				trace.meet(current.Element, forwardStack.Len()+backwardStack.Len())
 				allSteps := make(map[string][]string)
 				for k, v := range stepsCopy {
 					allSteps[k] = v
@@ -319,6 +381,7 @@ func BiSearchDFS(target string, elements map[string][][]string, basicElements ma
 				if isStepsComplete(allSteps, basicElements) {
 					path := reconstructPath(target, allSteps, basicElements, elements, tiers)
 					if path != nil {
+						trace.solution(target, forwardStack.Len()+backwardStack.Len())
 						return path, allSteps, nodesExplored, time.Since(startTime)
 					}
 				}
@@ -327,6 +390,7 @@ func BiSearchDFS(target string, elements map[string][][]string, basicElements ma
 			if current.Element == target && isStepsComplete(current.Steps, basicElements) {
 				path := reconstructPath(target, current.Steps, basicElements, elements, tiers)
 				if path != nil {
+					trace.solution(target, forwardStack.Len()+backwardStack.Len())
 					return path, current.Steps, nodesExplored, time.Since(startTime)
 				}
 			}
@@ -337,7 +401,8 @@ func BiSearchDFS(target string, elements map[string][][]string, basicElements ma
 			}
 			newAvailable[current.Element] = true
 
-			for resultElem, recipes := range elements {
+			for _, resultElem := range results {
+				recipes := elements[resultElem]
 				nodesExplored++ // Menambah hitungan untuk setiap elemen hasil yang diperiksa
 
 				if _, visited := forwardVisited[resultElem]; visited {
@@ -377,6 +442,7 @@ func BiSearchDFS(target string, elements map[string][][]string, basicElements ma
 							Steps:     newSteps,
 						}
 						forwardStack.PushBack(state)
+						trace.generate(resultElem, current.Element, []string{ing1, ing2}, TraceForward, forwardStack.Len())
 						nodesExplored++ // Menambah hitungan untuk setiap state baru yang ditambahkan
 					}
 				}
@@ -402,8 +468,10 @@ func BiSearchDFS(target string, elements map[string][][]string, basicElements ma
 				stepsCopy[k] = append([]string{}, v...)
 			}
 			backwardVisited[current.Element] = stepsCopy
+			trace.expand(current.Element, TraceBackward, backwardStack.Len())
 
 			if forwardSteps, found := forwardVisited[current.Element]; found {
+				trace.meet(current.Element, forwardStack.Len()+backwardStack.Len())
 				allSteps := make(map[string][]string)
 				for k, v := range forwardSteps {
 					allSteps[k] = v
@@ -414,6 +482,7 @@ func BiSearchDFS(target string, elements map[string][][]string, basicElements ma
 				if isStepsComplete(allSteps, basicElements) {
 					path := reconstructPath(target, allSteps, basicElements, elements, tiers)
 					if path != nil {
+						trace.solution(target, forwardStack.Len()+backwardStack.Len())
 						return path, allSteps, nodesExplored, time.Since(startTime)
 					}
 				}
@@ -454,6 +523,7 @@ func BiSearchDFS(target string, elements map[string][][]string, basicElements ma
 						}
 						state.Available[ing1] = true
 						backwardStack.PushBack(state)
+						trace.generate(ing1, current.Element, []string{ing1, ing2}, TraceBackward, backwardStack.Len())
 						nodesExplored++ // Menambah hitungan untuk setiap state baru yang ditambahkan
 					}
 				}
@@ -467,6 +537,7 @@ func BiSearchDFS(target string, elements map[string][][]string, basicElements ma
 						}
 						state.Available[ing2] = true
 						backwardStack.PushBack(state)
+						trace.generate(ing2, current.Element, []string{ing1, ing2}, TraceBackward, backwardStack.Len())
 						nodesExplored++ // Menambah hitungan untuk setiap state baru yang ditambahkan
 					}
 				}
@@ -478,6 +549,31 @@ func BiSearchDFS(target string, elements map[string][][]string, basicElements ma
 	return nil, nil, nodesExplored, time.Since(startTime)
 }
 
+// stepsReach reports whether steps hold a recipe for target and, in turn,
+// for every ingredient below it that is not a basic element.
+func stepsReach(target string, steps map[string][]string, basicElements map[string]bool) bool {
+	state := make(map[string]int) // 1 = sedang dicek, 2 = sudah lengkap
+
+	var reach func(elem string) bool
+	reach = func(elem string) bool {
+		if basicElements[elem] || state[elem] == 2 {
+			return true
+		}
+		ingredients := steps[elem]
+		if state[elem] == 1 || len(ingredients) != 2 {
+			return false
+		}
+		state[elem] = 1
+		if !reach(ingredients[0]) || !reach(ingredients[1]) {
+			return false
+		}
+		state[elem] = 2
+		return true
+	}
+
+	return reach(target)
+}
+
 func isStepsComplete(steps map[string][]string, basicElements map[string]bool) bool {
 	for _, ingredients := range steps {
 		for _, ing := range ingredients {
@@ -489,6 +585,17 @@ func isStepsComplete(steps map[string][]string, basicElements map[string]bool) b
 	return true
 }
 
+// sortedKeys returns the keys of m in order, for iterating a map
+// reproducibly.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 func cloneMap(src map[string]bool) map[string]bool {
 	copy := make(map[string]bool)
 	for k, v := range src {
@@ -529,9 +636,8 @@ func reconstructPath(target string, steps map[string][]string, basicElements map
 	var queue []string
 
 	// Tambahkan elemen dasar ke queue
-	for elem := range basicElements {
-		queue = append(queue, elem)
-	}
+	queue = append(queue, sortedKeys(basicElements)...)
+	pending := sortedKeys(dependsOn)
 
 	// Elemen yang sudah tersedia
 	available := make(map[string]bool)
@@ -556,7 +662,8 @@ func reconstructPath(target string, steps map[string][]string, basicElements map
 			break
 		}
 
-		for elem, ingredients := range dependsOn {
+		for _, elem := range pending {
+			ingredients := dependsOn[elem]
 			if available[elem] {
 				continue
 			}
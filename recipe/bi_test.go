@@ -0,0 +1,34 @@
+package recipe
+
+import (
+	"context"
+	"testing"
+)
+
+// TestBiSearchBFSKeepsMeetingPointRecipes guards against a meeting point
+// taking over its parent's recipe, which gave steps such as
+// Clay + Life = Clay on the way to Human.
+func TestBiSearchBFSKeepsMeetingPointRecipes(t *testing.T) {
+	g, err := LoadGraph("../recipes.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, _ := Lookup("bidirectional-bfs")
+
+	for _, target := range []string{"Human", "Golem"} {
+		t.Run(target, func(t *testing.T) {
+			res, err := s.FindSingle(context.Background(), g, Query{Target: target})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, step := range res.Paths[0].Steps {
+				for _, ing := range step.Ingredients {
+					if ing == step.Result {
+						t.Errorf("step %v uses its own result", step)
+					}
+				}
+			}
+			checkSteps(t, g, res.Paths[0])
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package recipe
+
+import "math/big"
+
+// RecipeCounter counts the distinct recipe trees of elements under the tier
+// rule. Because valid recipes always use lower-tier ingredients the graph is
+// a DAG, so count(e) = sum over recipes (a, b) of count(a) * count(b), with
+// every starting element counting as exactly one tree. The two ingredients of
+// a step are unordered, so A+A with n trees for A gives n(n+1)/2 trees, not
+// n², just as A+B and B+A are one recipe.
+type RecipeCounter struct {
+	g        *RecipeGraph
+	starting map[string]bool
+	memo     map[string]*big.Int
+}
+
+// NewRecipeCounter returns a counter for g; inventory elements are treated
+// as leaves like the basics. A counter caches its results and is not safe
+// for concurrent use.
+func NewRecipeCounter(g *RecipeGraph, inventory ...string) *RecipeCounter {
+	return &RecipeCounter{
+		g:        g,
+		starting: g.startingSet(inventory),
+		memo:     make(map[string]*big.Int),
+	}
+}
+
+// Count returns the number of distinct recipe trees for element. The result
+// must not be modified.
+func (c *RecipeCounter) Count(element string) *big.Int {
+	if n, ok := c.memo[element]; ok {
+		return n
+	}
+
+	total := new(big.Int)
+	if c.starting[element] {
+		total.SetInt64(1)
+	} else {
+		for _, combo := range c.recipes(element) {
+			total.Add(total, c.countRecipe(combo))
+		}
+	}
+
+	c.memo[element] = total
+	return total
+}
+
+// countRecipe returns the number of distinct trees that craft element with
+// combo as the final step.
+func (c *RecipeCounter) countRecipe(combo [2]string) *big.Int {
+	if combo[0] == combo[1] {
+		n := c.Count(combo[0])
+		pairs := new(big.Int).Add(n, big.NewInt(1))
+		pairs.Mul(pairs, n)
+		return pairs.Rsh(pairs, 1)
+	}
+	return new(big.Int).Mul(c.Count(combo[0]), c.Count(combo[1]))
+}
+
+// RecipeCount is the number of trees that finish with one particular recipe.
+type RecipeCount struct {
+	Ingredients [2]string
+	Count       *big.Int
+}
+
+// Breakdown returns, for each valid recipe of element, how many trees end
+// with that recipe. The counts add up to Count(element).
+func (c *RecipeCounter) Breakdown(element string) []RecipeCount {
+	var counts []RecipeCount
+	if c.starting[element] {
+		return counts
+	}
+	for _, combo := range c.recipes(element) {
+		counts = append(counts, RecipeCount{Ingredients: combo, Count: c.countRecipe(combo)})
+	}
+	return counts
+}
+
+// recipes returns the tier-valid recipes of element, with mirrored
+// duplicates (A+B and B+A) listed once.
+func (c *RecipeCounter) recipes(element string) [][2]string {
+	var recipes [][2]string
+	seen := make(map[[2]string]bool)
+	for _, combo := range c.g.recipeMap[element] {
+		if !c.g.validRecipe(element, combo) {
+			continue
+		}
+		key := [2]string{combo[0], combo[1]}
+		if key[1] < key[0] {
+			key[0], key[1] = key[1], key[0]
+		}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		recipes = append(recipes, [2]string{combo[0], combo[1]})
+	}
+	return recipes
+}
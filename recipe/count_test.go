@@ -0,0 +1,65 @@
+package recipe
+
+import (
+	"math/big"
+	"testing"
+)
+
+// countGraph has Dust with 2 trees, Sand = Dust+Dust (3 unordered pairs)
+// plus Dust+Water (2), and Stone = Sand+Sand (15) plus Sand+Dust (10).
+func countGraph() *RecipeGraph {
+	return NewRecipeGraph([]ElementData{
+		{Element: "Air"}, {Element: "Earth"}, {Element: "Fire"}, {Element: "Water"},
+		{Element: "Dust", Tier: 1, Recipes: [][]string{{"Air", "Earth"}, {"Air", "Fire"}}},
+		{Element: "Sand", Tier: 2, Recipes: [][]string{{"Dust", "Dust"}, {"Dust", "Water"}, {"Water", "Dust"}}},
+		// Stone + Air breaks the tier rule and is not counted
+		{Element: "Stone", Tier: 3, Recipes: [][]string{{"Sand", "Sand"}, {"Sand", "Dust"}, {"Stone", "Air"}}},
+	})
+}
+
+func TestCount(t *testing.T) {
+	tests := []struct {
+		element   string
+		inventory []string
+		want      int64
+	}{
+		{"Air", nil, 1},
+		{"Dust", nil, 2},
+		{"Sand", nil, 5},
+		{"Stone", nil, 25},
+		{"Dust", []string{"Dust"}, 1},
+		{"Sand", []string{"Dust"}, 2}, // Dust+Dust and Dust+Water
+		{"Stone", []string{"Sand"}, 3},
+		{"Unknown", nil, 0},
+	}
+	g := countGraph()
+	for _, tt := range tests {
+		c := NewRecipeCounter(g, tt.inventory...)
+		if got := c.Count(tt.element); got.Cmp(big.NewInt(tt.want)) != 0 {
+			t.Errorf("Count(%s) with inventory %v = %s, want %d", tt.element, tt.inventory, got, tt.want)
+		}
+	}
+}
+
+func TestCountBreakdown(t *testing.T) {
+	c := NewRecipeCounter(countGraph())
+	want := map[[2]string]int64{{"Sand", "Sand"}: 15, {"Sand", "Dust"}: 10}
+
+	breakdown := c.Breakdown("Stone")
+	if len(breakdown) != len(want) {
+		t.Fatalf("Breakdown(Stone) = %v, want %v", breakdown, want)
+	}
+	sum := new(big.Int)
+	for _, rc := range breakdown {
+		if rc.Count.Cmp(big.NewInt(want[rc.Ingredients])) != 0 {
+			t.Errorf("%v: %s trees, want %d", rc.Ingredients, rc.Count, want[rc.Ingredients])
+		}
+		sum.Add(sum, rc.Count)
+	}
+	if sum.Cmp(c.Count("Stone")) != 0 {
+		t.Errorf("breakdown sums to %s, Count is %s", sum, c.Count("Stone"))
+	}
+	if b := c.Breakdown("Air"); len(b) != 0 {
+		t.Errorf("Breakdown(Air) = %v, want none", b)
+	}
+}
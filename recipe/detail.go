@@ -0,0 +1,52 @@
+package recipe
+
+// ElementDetail is the full record served by /api/elements/{name}.
+type ElementDetail struct {
+	Element   string       `json:"element"`
+	ImageURL  string       `json:"image_url"`
+	Tier      int          `json:"tier"`
+	Basic     bool         `json:"basic"`
+	Recipes   []RecipeInfo `json:"recipes"`
+	Uses      []Use        `json:"uses"`
+	Reachable bool         `json:"reachable"`
+	Depth     *int         `json:"depth"` // null when not reachable
+}
+
+// RecipeInfo is one recipe of an element. Valid is false when it breaks the
+// tier rule, so the search algorithms never use it.
+type RecipeInfo struct {
+	Ingredients []string `json:"ingredients"`
+	Valid       bool     `json:"valid"`
+}
+
+// Detail collects everything known about element.
+func (g *RecipeGraph) Detail(element string) (ElementDetail, bool) {
+	data, ok := g.Element(element)
+	if !ok {
+		return ElementDetail{}, false
+	}
+
+	detail := ElementDetail{
+		Element:  data.Element,
+		ImageURL: data.ImageURL,
+		Tier:     g.tierMap[element],
+		Basic:    g.basics[element],
+		Recipes:  []RecipeInfo{},
+		Uses:     g.Uses(element),
+	}
+	if detail.Uses == nil {
+		detail.Uses = []Use{}
+	}
+	for _, combo := range data.Recipes {
+		detail.Recipes = append(detail.Recipes, RecipeInfo{
+			Ingredients: combo,
+			Valid:       g.validRecipe(element, combo),
+		})
+	}
+	if depth, ok := g.Depth(element); ok {
+		detail.Reachable = true
+		detail.Depth = &depth
+	}
+
+	return detail, true
+}
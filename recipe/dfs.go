@@ -1,6 +1,7 @@
 package recipe
 
 import (
+	"context"
 	"encoding/json"
 	"os"
 	"time"
@@ -37,7 +38,28 @@ type Step struct {
 	Result      string    `json:"result"`
 }
 
-func findPathDFS(recipes []ElementRecipe, startElements []string, target string) ([]Path, time.Duration, int) {
+func init() {
+	Register("dfs", dfsSearcher{})
+}
+
+type dfsSearcher struct{}
+
+func (dfsSearcher) FindSingle(ctx context.Context, g *RecipeGraph, q Query) (Result, error) {
+	path, visited, duration, err := FindSingleRecipeDFS(ctx, g, q.Target, g.StartingElements(q.Inventory...))
+	res := Result{Complete: ctx.Err() == nil, Stats: SearchStats{NodesVisited: visited, Duration: duration}}
+	if path != nil {
+		res.Paths = []Path{*path}
+	}
+	return res, err
+}
+
+func (dfsSearcher) FindMultiple(ctx context.Context, g *RecipeGraph, q Query) (Result, error) {
+	ctx = untraced(ctx) // see WithTrace
+	paths, visited, duration, err := FindMultipleRecipesDFSConcurrent(ctx, g, q.Target, g.StartingElements(q.Inventory...), q.MaxPaths, q.Seed)
+	return Result{Paths: paths, Complete: ctx.Err() == nil, Stats: SearchStats{NodesVisited: visited, Duration: duration}}, err
+}
+
+func findPathDFS(ctx context.Context, recipes []ElementRecipe, startElements []string, target string) ([]Path, time.Duration, int) {
 	startTime := time.Now()
 	elementMap := make(map[string]ElementRecipe) // just like the json
 	tierMap := make(map[string]int)              // element -> tier
@@ -57,6 +79,10 @@ func findPathDFS(recipes []ElementRecipe, startElements []string, target string)
 	memo := make(map[string]bool)
 	visitedCounter := make(map[string]bool)
 
+	// the frontier of a DFS is its recursion stack
+	trace := traceFrom(ctx)
+	depth := 0
+
 	// Tambahkan counter untuk menghitung total node yang dieksplorasi
 	nodesExplored := 0
 
@@ -70,6 +96,11 @@ func findPathDFS(recipes []ElementRecipe, startElements []string, target string)
 
 	var dfs func(string) *Path
 	dfs = func(current string) *Path {
+		// stop as soon as the search is cancelled, without memoizing the failure
+		if ctx.Err() != nil {
+			return nil
+		}
+
 		// Hitung current element sebagai node yang dieksplorasi
 		// Kecuali jika sudah pernah dihitung sebelumnya
 		if !visitedCounter[current] {
@@ -79,6 +110,10 @@ func findPathDFS(recipes []ElementRecipe, startElements []string, target string)
 		// Tandai sudah mengunjungi current element
 		visitedCounter[current] = true
 
+		depth++
+		defer func() { depth-- }()
+		trace.expand(current, "", depth)
+
 		if basics[current] { // return if target = basic elements
 			return &Path{Steps: []Step{}, FinalItem: current}
 		}
@@ -112,6 +147,9 @@ func findPathDFS(recipes []ElementRecipe, startElements []string, target string)
 				continue
 			}
 
+			trace.generate(a, current, []string{a, b}, "", depth+1)
+			trace.generate(b, current, []string{a, b}, "", depth+1)
+
 			//continue to the next combo if elements cant be crafted
 			//dfs karena ngabisin path nya A dulu baru ke B
 			pathA := dfs(a)
@@ -162,6 +200,7 @@ func findPathDFS(recipes []ElementRecipe, startElements []string, target string)
 	duration := time.Since(startTime)
 
 	if path != nil {
+		trace.solution(target, 0)
 		return []Path{*path}, duration, nodesExplored
 	}
 	return nil, duration, nodesExplored
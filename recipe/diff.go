@@ -0,0 +1,144 @@
+package recipe
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Change is a value that differs between two datasets.
+type Change[T any] struct {
+	From T `json:"from"`
+	To   T `json:"to"`
+}
+
+// ElementChange lists what changed for an element present in both datasets.
+// Recipes are compared without regard to ingredient order.
+type ElementChange struct {
+	Element        string          `json:"element"`
+	Tier           *Change[int]    `json:"tier,omitempty"`
+	ImageURL       *Change[string] `json:"image_url,omitempty"`
+	RecipesAdded   [][2]string     `json:"recipes_added,omitempty"`
+	RecipesRemoved [][2]string     `json:"recipes_removed,omitempty"`
+}
+
+// DatasetDiff is the difference between two datasets, by element name.
+type DatasetDiff struct {
+	Added   []string        `json:"added"`
+	Removed []string        `json:"removed"`
+	Changed []ElementChange `json:"changed"`
+}
+
+// Empty reports whether the two datasets hold the same data.
+func (d *DatasetDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// Diff compares two datasets. Everything is sorted by element name, and
+// recipes in the order they are listed. If a dataset lists an element more
+// than once, the last entry counts, as in NewRecipeGraph.
+func Diff(from, to []ElementData) *DatasetDiff {
+	d := &DatasetDiff{Added: []string{}, Removed: []string{}, Changed: []ElementChange{}}
+
+	before := indexElements(from)
+	after := indexElements(to)
+
+	for _, name := range sortedKeys(after) {
+		if _, ok := before[name]; !ok {
+			d.Added = append(d.Added, name)
+		}
+	}
+	for _, name := range sortedKeys(before) {
+		old := before[name]
+		cur, ok := after[name]
+		if !ok {
+			d.Removed = append(d.Removed, name)
+			continue
+		}
+
+		change := ElementChange{Element: name}
+		if old.Tier != cur.Tier {
+			change.Tier = &Change[int]{old.Tier, cur.Tier}
+		}
+		if old.ImageURL != cur.ImageURL {
+			change.ImageURL = &Change[string]{old.ImageURL, cur.ImageURL}
+		}
+		change.RecipesAdded = missingRecipes(cur.Recipes, old.Recipes)
+		change.RecipesRemoved = missingRecipes(old.Recipes, cur.Recipes)
+
+		if change.Tier != nil || change.ImageURL != nil || len(change.RecipesAdded) > 0 || len(change.RecipesRemoved) > 0 {
+			d.Changed = append(d.Changed, change)
+		}
+	}
+
+	return d
+}
+
+func indexElements(elements []ElementData) map[string]ElementData {
+	index := make(map[string]ElementData, len(elements))
+	for _, e := range elements {
+		index[e.Element] = e
+	}
+	return index
+}
+
+// missingRecipes returns the recipes of a that b does not have.
+func missingRecipes(a, b [][]string) [][2]string {
+	have := make(map[[2]string]bool, len(b))
+	for _, combo := range b {
+		if len(combo) == 2 {
+			have[recipeKey(combo[0], combo[1])] = true
+		}
+	}
+
+	var missing [][2]string
+	for _, combo := range a {
+		if len(combo) != 2 {
+			continue
+		}
+		key := recipeKey(combo[0], combo[1])
+		if !have[key] {
+			have[key] = true // a duplicate in a is reported once
+			missing = append(missing, [2]string{combo[0], combo[1]})
+		}
+	}
+	return missing
+}
+
+// recipeKey is the same for A+B and B+A.
+func recipeKey(a, b string) [2]string {
+	if a > b {
+		a, b = b, a
+	}
+	return [2]string{a, b}
+}
+
+// WriteText renders the diff for a terminal, one line per change.
+func (d *DatasetDiff) WriteText(w io.Writer) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d added, %d removed, %d changed\n", len(d.Added), len(d.Removed), len(d.Changed))
+	for _, name := range d.Added {
+		fmt.Fprintf(&b, "+ %s\n", name)
+	}
+	for _, name := range d.Removed {
+		fmt.Fprintf(&b, "- %s\n", name)
+	}
+	for _, c := range d.Changed {
+		fmt.Fprintf(&b, "~ %s\n", c.Element)
+		if c.Tier != nil {
+			fmt.Fprintf(&b, "    tier: %d -> %d\n", c.Tier.From, c.Tier.To)
+		}
+		if c.ImageURL != nil {
+			fmt.Fprintf(&b, "    image: %s -> %s\n", c.ImageURL.From, c.ImageURL.To)
+		}
+		for _, combo := range c.RecipesAdded {
+			fmt.Fprintf(&b, "    + %s + %s\n", combo[0], combo[1])
+		}
+		for _, combo := range c.RecipesRemoved {
+			fmt.Fprintf(&b, "    - %s + %s\n", combo[0], combo[1])
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
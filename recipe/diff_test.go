@@ -0,0 +1,67 @@
+package recipe
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	from := []ElementData{
+		{Element: "Air", Tier: 0, ImageURL: "air.png"},
+		{Element: "Mud", Tier: 1, Recipes: [][]string{{"Earth", "Water"}, {"Water", "Dust"}}},
+		{Element: "Steam", Tier: 1, Recipes: [][]string{{"Fire", "Water"}}},
+		{Element: "Old", Tier: 2},
+		{Element: "Dust", Tier: 1},
+		{Element: "Dust", Tier: 2}, // the last entry counts
+	}
+	to := []ElementData{
+		{Element: "Air", Tier: 0, ImageURL: "/assets/air.png"},
+		// mirrored recipes are the same recipe, a duplicate is added once
+		{Element: "Mud", Tier: 2, Recipes: [][]string{{"Water", "Earth"}, {"Earth", "Earth"}, {"Earth", "Earth"}}},
+		{Element: "Steam", Tier: 1, Recipes: [][]string{{"Water", "Fire"}}},
+		{Element: "New", Tier: 3},
+		{Element: "Dust", Tier: 2},
+	}
+
+	got := Diff(from, to)
+	want := &DatasetDiff{
+		Added:   []string{"New"},
+		Removed: []string{"Old"},
+		Changed: []ElementChange{
+			{Element: "Air", ImageURL: &Change[string]{"air.png", "/assets/air.png"}},
+			{
+				Element:        "Mud",
+				Tier:           &Change[int]{1, 2},
+				RecipesAdded:   [][2]string{{"Earth", "Earth"}},
+				RecipesRemoved: [][2]string{{"Water", "Dust"}},
+			},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Diff = %+v, want %+v", got, want)
+	}
+	if got.Empty() {
+		t.Error("the diff is empty")
+	}
+
+	var b strings.Builder
+	if err := got.WriteText(&b); err != nil {
+		t.Fatal(err)
+	}
+	text := "1 added, 1 removed, 2 changed\n+ New\n- Old\n~ Air\n    image: air.png -> /assets/air.png\n" +
+		"~ Mud\n    tier: 1 -> 2\n    + Earth + Earth\n    - Water + Dust\n"
+	if b.String() != text {
+		t.Errorf("WriteText =\n%s\nwant\n%s", b.String(), text)
+	}
+}
+
+func TestDiffIdentical(t *testing.T) {
+	elements := []ElementData{
+		{Element: "Air", Tier: 0},
+		{Element: "Mud", Tier: 1, Recipes: [][]string{{"Earth", "Water"}}},
+	}
+	if d := Diff(elements, elements); !d.Empty() {
+		t.Errorf("a dataset differs from itself: %+v", d)
+	}
+}
@@ -0,0 +1,60 @@
+package recipe
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+// Errors returned by the search entry points. Callers should test for them
+// with errors.Is, since they are usually wrapped in an ElementError.
+var (
+	ErrUnknownElement  = errors.New("unknown element")
+	ErrTargetIsBasic   = errors.New("target is already a starting element")
+	ErrUnreachable     = errors.New("no recipe reaches the target from the starting elements")
+	ErrDataUnavailable = errors.New("recipe data is unavailable")
+)
+
+// ElementError records which element an error is about. For an unknown
+// element, Suggestions holds the closest known names.
+type ElementError struct {
+	Element     string
+	Err         error
+	Suggestions []string
+}
+
+func (e *ElementError) Error() string {
+	msg := e.Err.Error() + ": " + e.Element
+	if len(e.Suggestions) > 0 {
+		msg += " (did you mean " + strings.Join(e.Suggestions, ", ") + "?)"
+	}
+	return msg
+}
+
+func (e *ElementError) Unwrap() error {
+	return e.Err
+}
+
+// checkTarget returns the error every entry point reports before searching:
+// no data, an unknown target, or a target the player already has.
+func checkTarget(g *RecipeGraph, target string, isStarting bool) error {
+	if g == nil {
+		return ErrDataUnavailable
+	}
+	if !g.Has(target) {
+		return g.unknownElement(target)
+	}
+	if isStarting {
+		return &ElementError{Element: target, Err: ErrTargetIsBasic}
+	}
+	return nil
+}
+
+// searchError is the error for a search that finished with no results. A
+// cancelled search is not an error: it just returns what it found so far.
+func searchError(ctx context.Context, target string, found int) error {
+	if found > 0 || ctx.Err() != nil {
+		return nil
+	}
+	return &ElementError{Element: target, Err: ErrUnreachable}
+}
@@ -0,0 +1,361 @@
+package recipe
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Fill colours shared by the diagram exports.
+const (
+	colorBasic     = "#b8e986" // basic elements
+	colorInventory = "#a4d8f0" // other starting elements
+	colorTarget    = "#ffd966"
+	colorCrafted   = "#ffffff"
+)
+
+// diagram is a recipe tree folded into a DAG: every element appears once,
+// with the first recipe the tree uses for it.
+type diagram struct {
+	target string
+	order  []string // dependency order: ingredients before their results
+	recipe map[string][2]string
+	tier   map[string]int
+	basic  map[string]bool
+}
+
+func newDiagram(g *RecipeGraph, root *RecipeNode) *diagram {
+	d := &diagram{
+		target: root.Element,
+		recipe: make(map[string][2]string),
+		tier:   make(map[string]int),
+		basic:  make(map[string]bool),
+	}
+
+	// marked on entry, so a malformed tree that uses an element inside its
+	// own recipe still lists it once
+	seen := make(map[string]bool)
+	var visit func(n *RecipeNode)
+	visit = func(n *RecipeNode) {
+		if seen[n.Element] {
+			return
+		}
+		seen[n.Element] = true
+		if len(n.Children) == 2 {
+			visit(n.Children[0])
+			visit(n.Children[1])
+			d.recipe[n.Element] = [2]string{n.Recipe[0], n.Recipe[1]}
+		}
+		d.tier[n.Element] = n.Tier
+		d.basic[n.Element] = g.basics[n.Element]
+		d.order = append(d.order, n.Element)
+	}
+	visit(root)
+
+	return d
+}
+
+func (d *diagram) color(elem string) string {
+	switch {
+	case elem == d.target:
+		return colorTarget
+	case d.basic[elem]:
+		return colorBasic
+	case !d.crafted(elem):
+		return colorInventory
+	}
+	return colorCrafted
+}
+
+func (d *diagram) crafted(elem string) bool {
+	_, ok := d.recipe[elem]
+	return ok
+}
+
+// edges returns ingredient -> result pairs in dependency order. A+A=B gives
+// a single edge.
+func (d *diagram) edges() [][2]string {
+	var edges [][2]string
+	for _, elem := range d.order {
+		combo, ok := d.recipe[elem]
+		if !ok {
+			continue
+		}
+		edges = append(edges, [2]string{combo[0], elem})
+		if combo[1] != combo[0] {
+			edges = append(edges, [2]string{combo[1], elem})
+		}
+	}
+	return edges
+}
+
+// ranks groups the elements by tier, lowest tier first.
+func (d *diagram) ranks() [][]string {
+	byTier := make(map[int][]string)
+	for _, elem := range d.order {
+		byTier[d.tier[elem]] = append(byTier[d.tier[elem]], elem)
+	}
+	tiers := make([]int, 0, len(byTier))
+	for tier := range byTier {
+		tiers = append(tiers, tier)
+	}
+	sort.Ints(tiers)
+
+	ranks := make([][]string, 0, len(tiers))
+	for _, tier := range tiers {
+		ranks = append(ranks, byTier[tier])
+	}
+	return ranks
+}
+
+// WriteDOT renders recipe trees as a Graphviz digraph, with edges from
+// ingredients to results and one rank per tier. Several trees are drawn as
+// separate clusters.
+func WriteDOT(w io.Writer, g *RecipeGraph, trees []*RecipeNode) error {
+	var b strings.Builder
+	b.WriteString("digraph recipe {\n")
+	b.WriteString("  rankdir=TB;\n")
+	b.WriteString("  node [shape=box, style=\"rounded,filled\", fontname=\"Helvetica\"];\n")
+
+	for i, root := range trees {
+		d := newDiagram(g, root)
+		indent := "  "
+		id := func(elem string) string { return dotQuote(elem) }
+		if len(trees) > 1 {
+			fmt.Fprintf(&b, "  subgraph cluster_%d {\n", i)
+			fmt.Fprintf(&b, "    label=%s;\n", dotQuote(fmt.Sprintf("Recipe %d", i+1)))
+			indent = "    "
+			prefix := fmt.Sprintf("%d:", i)
+			id = func(elem string) string { return dotQuote(prefix + elem) }
+		}
+
+		for _, elem := range d.order {
+			fmt.Fprintf(&b, "%s%s [label=%s, fillcolor=%s];\n", indent, id(elem), dotQuote(elem), dotQuote(d.color(elem)))
+		}
+		for _, rank := range d.ranks() {
+			ids := make([]string, len(rank))
+			for j, elem := range rank {
+				ids[j] = id(elem)
+			}
+			fmt.Fprintf(&b, "%s{ rank=same; %s; }\n", indent, strings.Join(ids, "; "))
+		}
+		for _, e := range d.edges() {
+			fmt.Fprintf(&b, "%s%s -> %s;\n", indent, id(e[0]), id(e[1]))
+		}
+
+		if len(trees) > 1 {
+			b.WriteString("  }\n")
+		}
+	}
+
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// dotQuote returns s as a DOT string literal.
+func dotQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return `"` + s + `"`
+}
+
+// SVG layout, in pixels.
+const (
+	svgNodeHeight = 30
+	svgMinWidth   = 70
+	svgCharWidth  = 7 // rough width of a 12px sans-serif character
+	svgHGap       = 20
+	svgVGap       = 50
+	svgMargin     = 20
+	svgTitle      = 24 // room for the recipe title above each panel
+)
+
+type svgBox struct {
+	x, y, w int
+}
+
+// WriteSVG renders recipe trees as a layered SVG without needing Graphviz.
+// Each tier in a tree is a row, lowest at the top, and every row is ordered
+// by the average position of its ingredients to keep edges short. Several
+// trees are drawn side by side.
+func WriteSVG(w io.Writer, g *RecipeGraph, trees []*RecipeNode) error {
+	var body strings.Builder
+	x0, height := svgMargin, 0
+
+	for i, root := range trees {
+		d := newDiagram(g, root)
+		ranks := d.ranks()
+
+		// widths first, so rows can be centred in the panel
+		boxes := make(map[string]*svgBox)
+		panelWidth := 0
+		for _, rank := range ranks {
+			rowWidth := -svgHGap
+			for _, elem := range rank {
+				boxes[elem] = &svgBox{w: max(svgMinWidth, svgCharWidth*len([]rune(elem))+24)}
+				rowWidth += boxes[elem].w + svgHGap
+			}
+			panelWidth = max(panelWidth, rowWidth)
+		}
+
+		top := svgMargin
+		if len(trees) > 1 {
+			fmt.Fprintf(&body, `<text x="%d" y="%d" font-weight="bold">Recipe %d</text>`+"\n", x0, top+14, i+1)
+			top += svgTitle
+		}
+
+		for r, rank := range ranks {
+			if r == 0 {
+				sort.Strings(rank)
+			} else {
+				orderByIngredients(rank, d, boxes)
+			}
+
+			rowWidth := -svgHGap
+			for _, elem := range rank {
+				rowWidth += boxes[elem].w + svgHGap
+			}
+			x := x0 + (panelWidth-rowWidth)/2
+			for _, elem := range rank {
+				boxes[elem].x = x
+				boxes[elem].y = top + r*(svgNodeHeight+svgVGap)
+				x += boxes[elem].w + svgHGap
+			}
+		}
+
+		for _, e := range d.edges() {
+			from, to := boxes[e[0]], boxes[e[1]]
+			fmt.Fprintf(&body, `<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="#555" marker-end="url(#arrow)"/>`+"\n",
+				from.x+from.w/2, from.y+svgNodeHeight, to.x+to.w/2, to.y)
+		}
+		for _, elem := range d.order {
+			box := boxes[elem]
+			fmt.Fprintf(&body, `<rect x="%d" y="%d" width="%d" height="%d" rx="6" fill="%s" stroke="#333"/>`+"\n",
+				box.x, box.y, box.w, svgNodeHeight, d.color(elem))
+			fmt.Fprintf(&body, `<text x="%d" y="%d" text-anchor="middle">%s</text>`+"\n",
+				box.x+box.w/2, box.y+svgNodeHeight/2+4, html.EscapeString(elem))
+		}
+
+		x0 += panelWidth + 2*svgMargin
+		height = max(height, top+len(ranks)*(svgNodeHeight+svgVGap)-svgVGap+svgMargin)
+	}
+
+	width := max(x0-svgMargin, 2*svgMargin)
+	height = max(height, 2*svgMargin)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="Helvetica, Arial, sans-serif" font-size="12">`+"\n",
+		width, height, width, height)
+	b.WriteString(`<defs><marker id="arrow" viewBox="0 0 10 10" refX="10" refY="5" markerWidth="6" markerHeight="6" orient="auto-start-reverse"><path d="M 0 0 L 10 5 L 0 10 z" fill="#555"/></marker></defs>` + "\n")
+	fmt.Fprintf(&b, `<rect width="%d" height="%d" fill="#ffffff"/>`+"\n", width, height)
+	b.WriteString(body.String())
+	b.WriteString("</svg>\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// orderByIngredients sorts a row by the mean x of each element's
+// ingredients, which are all in rows above and already placed.
+func orderByIngredients(rank []string, d *diagram, boxes map[string]*svgBox) {
+	center := func(elem string) float64 {
+		combo, ok := d.recipe[elem]
+		if !ok {
+			return 0
+		}
+		a, b := boxes[combo[0]], boxes[combo[1]]
+		return float64(a.x+a.w/2+b.x+b.w/2) / 2
+	}
+	sort.SliceStable(rank, func(i, j int) bool {
+		ci, cj := center(rank[i]), center(rank[j])
+		if ci != cj {
+			return ci < cj
+		}
+		return rank[i] < rank[j]
+	})
+}
+
+// WriteMermaid renders recipe trees as a Mermaid "graph TD" flowchart.
+// Several trees become separate subgraphs.
+func WriteMermaid(w io.Writer, g *RecipeGraph, trees []*RecipeNode) error {
+	var b strings.Builder
+	b.WriteString("graph TD\n")
+	fmt.Fprintf(&b, "  classDef basic fill:%s,stroke:#333\n", colorBasic)
+	fmt.Fprintf(&b, "  classDef inventory fill:%s,stroke:#333\n", colorInventory)
+	fmt.Fprintf(&b, "  classDef target fill:%s,stroke:#333\n", colorTarget)
+
+	for i, root := range trees {
+		d := newDiagram(g, root)
+		indent := "  "
+		prefix := "n"
+		if len(trees) > 1 {
+			fmt.Fprintf(&b, "  subgraph r%d[\"Recipe %d\"]\n", i+1, i+1)
+			indent = "    "
+			prefix = fmt.Sprintf("r%dn", i+1)
+		}
+
+		// Mermaid ids cannot hold arbitrary names, so nodes are numbered
+		ids := make(map[string]string, len(d.order))
+		for j, elem := range d.order {
+			ids[elem] = fmt.Sprintf("%s%d", prefix, j)
+			fmt.Fprintf(&b, "%s%s[\"%s\"]\n", indent, ids[elem], mermaidEscape(elem))
+		}
+		for _, e := range d.edges() {
+			fmt.Fprintf(&b, "%s%s --> %s\n", indent, ids[e[0]], ids[e[1]])
+		}
+		for _, elem := range d.order {
+			switch d.color(elem) {
+			case colorTarget:
+				fmt.Fprintf(&b, "%sclass %s target\n", indent, ids[elem])
+			case colorBasic:
+				fmt.Fprintf(&b, "%sclass %s basic\n", indent, ids[elem])
+			case colorInventory:
+				fmt.Fprintf(&b, "%sclass %s inventory\n", indent, ids[elem])
+			}
+		}
+
+		if len(trees) > 1 {
+			b.WriteString("  end\n")
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// mermaidEscape makes s safe inside a quoted Mermaid label.
+func mermaidEscape(s string) string {
+	return strings.ReplaceAll(s, `"`, "#quot;")
+}
+
+// WriteMarkdown renders recipe trees as numbered "A + B = C" lists, each
+// step after the steps that make its ingredients. Several trees get a
+// heading each.
+func WriteMarkdown(w io.Writer, g *RecipeGraph, trees []*RecipeNode) error {
+	var b strings.Builder
+	for i, root := range trees {
+		d := newDiagram(g, root)
+		if len(trees) > 1 {
+			if i > 0 {
+				b.WriteString("\n")
+			}
+			fmt.Fprintf(&b, "### Recipe %d\n\n", i+1)
+		}
+
+		n := 1
+		for _, elem := range d.order {
+			combo, ok := d.recipe[elem]
+			if !ok {
+				continue
+			}
+			fmt.Fprintf(&b, "%d. %s + %s = %s\n", n, combo[0], combo[1], elem)
+			n++
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
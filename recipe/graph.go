@@ -0,0 +1,263 @@
+package recipe
+
+import (
+	"fmt"
+	"sort"
+)
+
+// RecipeGraph is an immutable, in-memory view of a recipes dataset. It is
+// built once (see LoadGraph) and shared by every search, so nothing returned
+// by its accessors may be modified by the caller.
+type RecipeGraph struct {
+	elements  []ElementData
+	index     map[string]int // element -> position in elements
+	records   []ElementRecipe
+	recipeMap map[string][][]string
+	tierMap   map[string]int
+	basics    map[string]bool
+	starting  []string
+	uses      map[string][]Use  // ingredient -> recipes it takes part in
+	depths    map[string]int    // minimum crafting depth, reachable elements only
+	folded    map[string]string // FoldName(element) -> element
+}
+
+// Use is one recipe an element takes part in as an ingredient. Valid is
+// false when the recipe breaks the tier rule, so no search will use it.
+type Use struct {
+	Result  string `json:"result"`
+	Partner string `json:"partner"`
+	Tier    int    `json:"tier"`
+	Valid   bool   `json:"valid"`
+}
+
+// LoadGraph reads a recipes file and builds its RecipeGraph. Failures wrap
+// ErrDataUnavailable.
+func LoadGraph(filename string) (*RecipeGraph, error) {
+	elements, err := LoadElements(filename)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDataUnavailable, err)
+	}
+	return NewRecipeGraph(elements), nil
+}
+
+// NewRecipeGraph precomputes every lookup structure the search algorithms
+// need from the raw element list. basicElements are the starting elements
+// of the game, DefaultBasicElements if none are given.
+func NewRecipeGraph(elements []ElementData, basicElements ...string) *RecipeGraph {
+	recipeMap, tierMap, basics := PrepareElementMaps(elements, basicElements...)
+
+	index := make(map[string]int, len(elements))
+	records := make([]ElementRecipe, 0, len(elements))
+	for i, e := range elements {
+		index[e.Element] = i
+		record := ElementRecipe{
+			Element:  e.Element,
+			ImageURL: e.ImageURL,
+			Recipes:  make([][2]string, 0, len(e.Recipes)),
+			Tier:     e.Tier,
+		}
+		for _, combo := range e.Recipes {
+			if len(combo) == 2 {
+				record.Recipes = append(record.Recipes, [2]string{combo[0], combo[1]})
+			}
+		}
+		records = append(records, record)
+	}
+
+	starting := make([]string, 0, len(basics))
+	for elem := range basics {
+		starting = append(starting, elem)
+	}
+	sort.Strings(starting)
+
+	g := &RecipeGraph{
+		elements:  elements,
+		index:     index,
+		records:   records,
+		recipeMap: recipeMap,
+		tierMap:   tierMap,
+		basics:    basics,
+		starting:  starting,
+		folded:    buildFolded(elements),
+	}
+	g.uses = buildUses(g)
+	g.depths = craftDepths(elements, basics, g.validRecipe)
+	return g
+}
+
+// craftDepths returns the minimum crafting depth of every element that can
+// be made from starting using the recipes accepted by use. Starting elements
+// have depth 0 and a recipe adds one to the deeper of its two ingredients.
+// Elements are reached in rounds, so the first round that reaches an element
+// is its minimum depth.
+func craftDepths(elements []ElementData, starting map[string]bool, use func(result string, combo []string) bool) map[string]int {
+	depths := make(map[string]int, len(elements))
+	for elem := range starting {
+		depths[elem] = 0
+	}
+
+	for depth := 1; ; depth++ {
+		var reached []string
+		for _, e := range elements {
+			if _, done := depths[e.Element]; done {
+				continue
+			}
+			for _, combo := range e.Recipes {
+				if len(combo) != 2 || !use(e.Element, combo) {
+					continue
+				}
+				_, okA := depths[combo[0]]
+				_, okB := depths[combo[1]]
+				if okA && okB {
+					reached = append(reached, e.Element)
+					break
+				}
+			}
+		}
+		if len(reached) == 0 {
+			return depths
+		}
+		// assigned after the scan so this round only builds on earlier ones
+		for _, elem := range reached {
+			depths[elem] = depth
+		}
+	}
+}
+
+// Depth returns the minimum crafting depth of element from the basics under
+// the tier rule. ok is false if the element cannot be crafted at all.
+func (g *RecipeGraph) Depth(element string) (depth int, ok bool) {
+	depth, ok = g.depths[element]
+	return depth, ok
+}
+
+// buildUses indexes every recipe by its ingredients. A+A=B is listed once
+// under A, with A as its own partner.
+func buildUses(g *RecipeGraph) map[string][]Use {
+	uses := make(map[string][]Use)
+	for _, e := range g.elements {
+		for _, combo := range e.Recipes {
+			if len(combo) != 2 {
+				continue
+			}
+			valid := g.validRecipe(e.Element, combo)
+			uses[combo[0]] = append(uses[combo[0]], Use{Result: e.Element, Partner: combo[1], Tier: e.Tier, Valid: valid})
+			if combo[1] != combo[0] {
+				uses[combo[1]] = append(uses[combo[1]], Use{Result: e.Element, Partner: combo[0], Tier: e.Tier, Valid: valid})
+			}
+		}
+	}
+
+	for _, list := range uses {
+		sort.Slice(list, func(i, j int) bool {
+			if list[i].Tier != list[j].Tier {
+				return list[i].Tier < list[j].Tier
+			}
+			if list[i].Result != list[j].Result {
+				return list[i].Result < list[j].Result
+			}
+			return list[i].Partner < list[j].Partner
+		})
+	}
+	return uses
+}
+
+// Uses returns the recipes element is an ingredient of, ordered by result
+// tier and name.
+func (g *RecipeGraph) Uses(element string) []Use {
+	return g.uses[element]
+}
+
+// Elements returns the elements in the order they appear in the dataset.
+func (g *RecipeGraph) Elements() []ElementData {
+	return g.elements
+}
+
+// Element returns the dataset entry for name.
+func (g *RecipeGraph) Element(name string) (ElementData, bool) {
+	i, ok := g.index[name]
+	if !ok {
+		return ElementData{}, false
+	}
+	return g.elements[i], true
+}
+
+// RecipeMap returns element -> recipes, as used by the bidirectional searches.
+func (g *RecipeGraph) RecipeMap() map[string][][]string {
+	return g.recipeMap
+}
+
+// TierMap returns element -> tier, with the basic elements at tier 0.
+func (g *RecipeGraph) TierMap() map[string]int {
+	return g.tierMap
+}
+
+// BasicElements returns the set of basic elements.
+func (g *RecipeGraph) BasicElements() map[string]bool {
+	return g.basics
+}
+
+// StartingElements returns the basic elements plus any extra inventory the
+// player already has, sorted and without duplicates.
+func (g *RecipeGraph) StartingElements(inventory ...string) []string {
+	if g == nil {
+		return nil
+	}
+	if len(inventory) == 0 {
+		return g.starting
+	}
+
+	set := g.startingSet(inventory)
+	starting := make([]string, 0, len(set))
+	for elem := range set {
+		starting = append(starting, elem)
+	}
+	sort.Strings(starting)
+	return starting
+}
+
+// startingSet is StartingElements as a set, the form the bidirectional
+// searches take.
+func (g *RecipeGraph) startingSet(inventory []string) map[string]bool {
+	if g == nil {
+		return nil
+	}
+	if len(inventory) == 0 {
+		return g.basics
+	}
+
+	set := make(map[string]bool, len(g.basics)+len(inventory))
+	for elem := range g.basics {
+		set[elem] = true
+	}
+	for _, elem := range inventory {
+		set[elem] = true
+	}
+	return set
+}
+
+// Has reports whether element is defined in the dataset.
+func (g *RecipeGraph) Has(element string) bool {
+	_, ok := g.tierMap[element]
+	return ok
+}
+
+// validRecipe reports whether combo may be used to craft result: both
+// ingredients must be known and of a strictly lower tier. This is the same
+// rule every search algorithm applies, and it keeps the graph acyclic.
+func (g *RecipeGraph) validRecipe(result string, combo []string) bool {
+	if len(combo) != 2 {
+		return false
+	}
+	resultTier, ok := g.tierMap[result]
+	if !ok {
+		return false
+	}
+	for _, ing := range combo {
+		tier, ok := g.tierMap[ing]
+		if !ok || tier >= resultTier {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,249 @@
+package recipe
+
+import (
+	"container/heap"
+	"context"
+	"sort"
+	"time"
+)
+
+func init() {
+	Register("optimal", optimalSearcher{})
+}
+
+// optimalSearcher finds recipe trees with the fewest crafting steps using
+// Knuth's generalization of Dijkstra's algorithm to AND-OR graphs: an
+// element is an OR node over its recipes, a recipe is an AND node over its
+// two ingredients, and the cost of crafting through a recipe is
+// 1 + cost(a) + cost(b). That function is monotone in both arguments, so
+// the first time an element is popped from the queue its cost is minimal.
+type optimalSearcher struct{}
+
+func (optimalSearcher) FindSingle(ctx context.Context, g *RecipeGraph, q Query) (Result, error) {
+	if err := checkTarget(g, q.Target, g.startingSet(q.Inventory)[q.Target]); err != nil {
+		return Result{}, err
+	}
+
+	start := time.Now()
+	sol := solveOptimal(ctx, g, q.Target, q.Inventory, true)
+
+	res := Result{Complete: ctx.Err() == nil, Stats: SearchStats{NodesVisited: sol.settled}}
+	if combo, ok := sol.best[q.Target]; ok {
+		res.Paths = []Path{sol.path(q.Target, combo)}
+	}
+	res.Stats.Duration = time.Since(start)
+	return res, searchError(ctx, q.Target, len(res.Paths))
+}
+
+// FindMultiple returns, for each recipe of the target, the cheapest tree
+// that ends with that recipe, cheapest first. The first one is the optimum.
+func (optimalSearcher) FindMultiple(ctx context.Context, g *RecipeGraph, q Query) (Result, error) {
+	if err := checkTarget(g, q.Target, g.startingSet(q.Inventory)[q.Target]); err != nil {
+		return Result{}, err
+	}
+
+	start := time.Now()
+	sol := solveOptimal(ctx, g, q.Target, q.Inventory, false)
+
+	res := Result{Complete: ctx.Err() == nil, Stats: SearchStats{NodesVisited: sol.settled}}
+
+	type alternative struct {
+		combo [2]string
+		cost  int
+	}
+	var alternatives []alternative
+	for _, combo := range g.recipeMap[q.Target] {
+		if !g.validRecipe(q.Target, combo) {
+			continue
+		}
+		costA, okA := sol.cost[combo[0]]
+		costB, okB := sol.cost[combo[1]]
+		if okA && okB {
+			alternatives = append(alternatives, alternative{[2]string{combo[0], combo[1]}, 1 + costA + costB})
+		}
+	}
+	sort.SliceStable(alternatives, func(i, j int) bool {
+		return alternatives[i].cost < alternatives[j].cost
+	})
+
+	seen := make(map[string]bool)
+	for _, alt := range alternatives {
+		if len(res.Paths) >= q.MaxPaths {
+			break
+		}
+		p := sol.path(q.Target, alt.combo)
+		if sig := generateSignature(p); !seen[sig] {
+			seen[sig] = true
+			res.Paths = append(res.Paths, p)
+		}
+	}
+	res.Stats.Duration = time.Since(start)
+	return res, searchError(ctx, q.Target, len(res.Paths))
+}
+
+// OptimalRecipe returns a recipe for target with the minimum number of
+// crafting steps, and that number.
+func OptimalRecipe(ctx context.Context, g *RecipeGraph, target string, inventory ...string) (Path, int, error) {
+	if err := checkTarget(g, target, g.startingSet(inventory)[target]); err != nil {
+		return Path{}, 0, err
+	}
+
+	sol := solveOptimal(ctx, g, target, inventory, true)
+	combo, ok := sol.best[target]
+	if !ok {
+		return Path{}, 0, searchError(ctx, target, 0)
+	}
+	return sol.path(target, combo), sol.cost[target], nil
+}
+
+type optimalSolution struct {
+	starting map[string]bool
+	cost     map[string]int       // settled elements only
+	best     map[string][2]string // recipe that achieves cost
+	settled  int
+}
+
+// solveOptimal settles elements in order of increasing cost. With stopAtTarget
+// it returns as soon as target is settled; otherwise it settles everything
+// reachable.
+func solveOptimal(ctx context.Context, g *RecipeGraph, target string, inventory []string, stopAtTarget bool) *optimalSolution {
+	sol := &optimalSolution{
+		starting: g.startingSet(inventory),
+		cost:     make(map[string]int),
+		best:     make(map[string][2]string),
+	}
+
+	// recipe i crafts results[i] from combos[i]; pending[i] counts the
+	// distinct ingredients that are not settled yet
+	var (
+		results []string
+		combos  [][2]string
+		pending []int
+		usedIn  = make(map[string][]int)
+	)
+	for _, elem := range g.elements {
+		if sol.starting[elem.Element] {
+			continue
+		}
+		for _, combo := range elem.Recipes {
+			if !g.validRecipe(elem.Element, combo) {
+				continue
+			}
+			i := len(results)
+			results = append(results, elem.Element)
+			combos = append(combos, [2]string{combo[0], combo[1]})
+			usedIn[combo[0]] = append(usedIn[combo[0]], i)
+			if combo[1] != combo[0] {
+				usedIn[combo[1]] = append(usedIn[combo[1]], i)
+				pending = append(pending, 2)
+			} else {
+				pending = append(pending, 1)
+			}
+		}
+	}
+
+	trace := traceFrom(ctx)
+	tentative := make(map[string]int)
+	pq := &costQueue{}
+	for _, elem := range g.StartingElements(inventory...) {
+		tentative[elem] = 0
+		heap.Push(pq, costItem{elem, 0})
+	}
+
+	for pq.Len() > 0 {
+		if ctx.Err() != nil {
+			break
+		}
+
+		item := heap.Pop(pq).(costItem)
+		if _, settled := sol.cost[item.elem]; settled || item.cost > tentative[item.elem] {
+			continue
+		}
+		sol.cost[item.elem] = item.cost
+		sol.settled++
+		trace.expand(item.elem, "", pq.Len())
+
+		if item.elem == target {
+			trace.solution(target, pq.Len())
+			if stopAtTarget {
+				break
+			}
+		}
+
+		for _, i := range usedIn[item.elem] {
+			pending[i]--
+			if pending[i] > 0 {
+				continue
+			}
+			result := results[i]
+			if _, settled := sol.cost[result]; settled {
+				continue
+			}
+			cost := 1 + sol.cost[combos[i][0]] + sol.cost[combos[i][1]]
+			if old, seen := tentative[result]; !seen || cost < old {
+				tentative[result] = cost
+				sol.best[result] = combos[i]
+				heap.Push(pq, costItem{result, cost})
+				trace.generate(result, item.elem, combos[i][:], "", pq.Len())
+			}
+		}
+	}
+
+	// drop tentative recipes for elements that never got settled
+	for elem := range sol.best {
+		if _, settled := sol.cost[elem]; !settled {
+			delete(sol.best, elem)
+		}
+	}
+
+	return sol
+}
+
+// path expands the cheapest recipes below combo into a Path for target.
+func (sol *optimalSolution) path(target string, combo [2]string) Path {
+	path := Path{Steps: []Step{}, FinalItem: target}
+	done := make(map[string]bool)
+
+	var visit func(elem string)
+	visit = func(elem string) {
+		if done[elem] || sol.starting[elem] {
+			return
+		}
+		done[elem] = true
+		c := sol.best[elem]
+		visit(c[0])
+		visit(c[1])
+		path.Steps = append(path.Steps, Step{Ingredients: c, Result: elem})
+	}
+
+	done[target] = true
+	visit(combo[0])
+	visit(combo[1])
+	path.Steps = append(path.Steps, Step{Ingredients: combo, Result: target})
+
+	return path
+}
+
+type costItem struct {
+	elem string
+	cost int
+}
+
+// costQueue is a min-heap on cost, ties broken by name for stable output.
+type costQueue []costItem
+
+func (q costQueue) Len() int { return len(q) }
+func (q costQueue) Less(i, j int) bool {
+	if q[i].cost != q[j].cost {
+		return q[i].cost < q[j].cost
+	}
+	return q[i].elem < q[j].elem
+}
+func (q costQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+func (q *costQueue) Push(x any)   { *q = append(*q, x.(costItem)) }
+func (q *costQueue) Pop() any {
+	old := *q
+	item := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return item
+}
@@ -0,0 +1,117 @@
+package recipe
+
+import (
+	"context"
+	"testing"
+)
+
+// detourGraph is a graph where Goal's first recipe needs a long chain of
+// intermediates, while its second recipe is two steps from the basics.
+func detourGraph() *RecipeGraph {
+	return NewRecipeGraph([]ElementData{
+		{Element: "Air", Tier: 0},
+		{Element: "Earth", Tier: 0},
+		{Element: "Fire", Tier: 0},
+		{Element: "Water", Tier: 0},
+		{Element: "Dust", Tier: 1, Recipes: [][]string{{"Air", "Earth"}}},
+		{Element: "Sand", Tier: 2, Recipes: [][]string{{"Dust", "Dust"}}},
+		{Element: "Glass", Tier: 3, Recipes: [][]string{{"Sand", "Fire"}}},
+		{Element: "Lens", Tier: 4, Recipes: [][]string{{"Glass", "Glass"}}},
+		{Element: "Steam", Tier: 1, Recipes: [][]string{{"Water", "Fire"}}},
+		{Element: "Goal", Tier: 5, Recipes: [][]string{{"Lens", "Dust"}, {"Steam", "Steam"}}},
+	})
+}
+
+// treeCost is the cost optimal minimizes: 1 per crafting step of the
+// expanded tree, so an ingredient used twice is paid for twice.
+func treeCost(g *RecipeGraph, p Path) int {
+	recipeOf := make(map[string][2]string)
+	for _, s := range p.Steps {
+		recipeOf[s.Result] = s.Ingredients
+	}
+	var cost func(elem string) int
+	cost = func(elem string) int {
+		combo, ok := recipeOf[elem]
+		if !ok || g.BasicElements()[elem] {
+			return 0
+		}
+		return 1 + cost(combo[0]) + cost(combo[1])
+	}
+	return cost(p.FinalItem)
+}
+
+// checkSteps fails unless every step of p only uses basics or results of
+// earlier steps, and crafts an element of a higher tier than its ingredients.
+func checkSteps(t *testing.T, g *RecipeGraph, p Path) {
+	t.Helper()
+	have := g.BasicElements()
+	crafted := make(map[string]bool)
+	for i, s := range p.Steps {
+		for _, ing := range s.Ingredients {
+			if !have[ing] && !crafted[ing] {
+				t.Errorf("step %d %v: %s is used before it is crafted", i, s, ing)
+			}
+		}
+		if !g.validRecipe(s.Result, s.Ingredients[:]) {
+			t.Errorf("step %d %v breaks the tier rule", i, s)
+		}
+		crafted[s.Result] = true
+	}
+	if !crafted[p.FinalItem] {
+		t.Errorf("path never crafts %s", p.FinalItem)
+	}
+}
+
+func TestOptimalBeatsFirstRecipe(t *testing.T) {
+	g := detourGraph()
+	ctx := context.Background()
+
+	path, cost, err := OptimalRecipe(ctx, g, "Goal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Steam twice, then Goal; Lens + Dust would cost 11
+	if cost != 3 {
+		t.Errorf("cost = %d, want 3", cost)
+	}
+	if got := treeCost(g, path); got != cost {
+		t.Errorf("path costs %d, solver says %d", got, cost)
+	}
+	checkSteps(t, g, path)
+
+	// the premise: a search taking the first recipe pays for the detour
+	dfs, _ := Lookup("dfs")
+	res, err := dfs.FindSingle(ctx, g, Query{Target: "Goal"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := treeCost(g, res.Paths[0]); got <= cost {
+		t.Fatalf("dfs found a tree of cost %d, the graph no longer has a cheaper second recipe", got)
+	}
+}
+
+func TestOptimalNeverLoses(t *testing.T) {
+	g := detourGraph()
+	ctx := context.Background()
+
+	optimal, _ := Lookup("optimal")
+	best, err := optimal.FindSingle(ctx, g, Query{Target: "Goal"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cost := treeCost(g, best.Paths[0])
+
+	for _, name := range Algorithms() {
+		s, _ := Lookup(name)
+		res, err := s.FindMultiple(ctx, g, Query{Target: "Goal", MaxPaths: 5})
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		for _, p := range res.Paths {
+			checkSteps(t, g, p)
+			if got := treeCost(g, p); got < cost {
+				t.Errorf("%s found a tree of cost %d, cheaper than optimal's %d", name, got, cost)
+			}
+		}
+	}
+}
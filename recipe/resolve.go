@@ -0,0 +1,194 @@
+package recipe
+
+import (
+	"sort"
+	"strings"
+)
+
+// maxSuggestions caps the "did you mean" list of an unknown element.
+const maxSuggestions = 5
+
+// Suggestion is one autocomplete candidate.
+type Suggestion struct {
+	Element  string `json:"element"`
+	Tier     int    `json:"tier"`
+	ImageURL string `json:"image_url"`
+}
+
+// FoldName is the form names are compared in: lower case, trimmed, with
+// inner whitespace collapsed to single spaces.
+func FoldName(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
+
+// buildFolded maps every folded element name to the element.
+func buildFolded(elements []ElementData) map[string]string {
+	folded := make(map[string]string, len(elements))
+	for _, e := range elements {
+		key := FoldName(e.Element)
+		// on a clash the exact spelling still resolves, keep the first one
+		if _, ok := folded[key]; !ok {
+			folded[key] = e.Element
+		}
+	}
+	return folded
+}
+
+// Resolve maps a user supplied name to the element it means, ignoring case
+// and extra whitespace. An unknown name returns an ElementError wrapping
+// ErrUnknownElement with the closest names as suggestions.
+func (g *RecipeGraph) Resolve(name string) (string, error) {
+	if g.Has(name) {
+		return name, nil
+	}
+	if elem, ok := g.folded[FoldName(name)]; ok {
+		return elem, nil
+	}
+	return "", g.unknownElement(name)
+}
+
+func (g *RecipeGraph) unknownElement(name string) error {
+	return &ElementError{Element: name, Err: ErrUnknownElement, Suggestions: g.DidYouMean(name)}
+}
+
+// DidYouMean returns the elements closest to name by edit distance, closest
+// first. Names that are too far off to be a typo are left out.
+func (g *RecipeGraph) DidYouMean(name string) []string {
+	query := []rune(FoldName(name))
+	if len(query) == 0 {
+		return nil
+	}
+	limit := 1 + len(query)/4
+
+	type candidate struct {
+		elem string
+		dist int
+	}
+	var candidates []candidate
+	for key, elem := range g.folded {
+		if d := editDistance(query, []rune(key), limit); d <= limit {
+			candidates = append(candidates, candidate{elem, d})
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].dist != candidates[j].dist {
+			return candidates[i].dist < candidates[j].dist
+		}
+		if ti, tj := g.tierMap[candidates[i].elem], g.tierMap[candidates[j].elem]; ti != tj {
+			return ti < tj
+		}
+		return candidates[i].elem < candidates[j].elem
+	})
+
+	var names []string
+	for i := 0; i < len(candidates) && i < maxSuggestions; i++ {
+		names = append(names, candidates[i].elem)
+	}
+	return names
+}
+
+// Suggest returns up to limit elements for autocomplete. Names starting
+// with q come first, then names with a word starting with q, then names
+// containing q; each group is ordered by tier and name. If nothing matches,
+// the edit distance suggestions are returned instead.
+func (g *RecipeGraph) Suggest(q string, limit int) []Suggestion {
+	query := FoldName(q)
+	if query == "" || limit <= 0 {
+		return []Suggestion{}
+	}
+
+	rank := func(key string) int {
+		switch {
+		case strings.HasPrefix(key, query):
+			return 0
+		case strings.Contains(key, " "+query):
+			return 1
+		case strings.Contains(key, query):
+			return 2
+		}
+		return -1
+	}
+
+	type match struct {
+		elem string
+		rank int
+	}
+	var matches []match
+	for key, elem := range g.folded {
+		if r := rank(key); r >= 0 {
+			matches = append(matches, match{elem, r})
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].rank != matches[j].rank {
+			return matches[i].rank < matches[j].rank
+		}
+		if ti, tj := g.tierMap[matches[i].elem], g.tierMap[matches[j].elem]; ti != tj {
+			return ti < tj
+		}
+		return matches[i].elem < matches[j].elem
+	})
+
+	var names []string
+	for _, m := range matches {
+		names = append(names, m.elem)
+	}
+	if len(names) == 0 {
+		names = g.DidYouMean(q)
+	}
+
+	suggestions := []Suggestion{}
+	for _, elem := range names {
+		if len(suggestions) >= limit {
+			break
+		}
+		data, _ := g.Element(elem)
+		suggestions = append(suggestions, Suggestion{Element: elem, Tier: g.tierMap[elem], ImageURL: data.ImageURL})
+	}
+	return suggestions
+}
+
+// editDistance is the optimal string alignment distance between a and b:
+// insertions, deletions, substitutions and swaps of adjacent runes all cost
+// one. It gives up early and returns limit+1 once every alignment is over
+// limit.
+func editDistance(a, b []rune, limit int) int {
+	if abs(len(a)-len(b)) > limit {
+		return limit + 1
+	}
+
+	prev2 := make([]int, len(b)+1)
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		rowMin := curr[0]
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				curr[j] = min(curr[j], prev2[j-2]+1)
+			}
+			rowMin = min(rowMin, curr[j])
+		}
+		if rowMin > limit {
+			return limit + 1
+		}
+		prev2, prev, curr = prev, curr, prev2
+	}
+	return prev[len(b)]
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,112 @@
+package recipe
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Query describes what a Searcher should look for. Inventory lists elements
+// the player already has on top of the basics; searches treat them as free
+// leaves, exactly like the basic elements.
+//
+// A nil Seed lets the multiple mode searches run as fast as they can, so the
+// set of recipes they return may change from call to call. With a Seed, the
+// recipe orders they try are derived from it and results are put back in
+// attempt order, so the same query and seed always give the same result.
+type Query struct {
+	Target    string
+	MaxPaths  int // only used in multiple mode
+	Inventory []string
+	Seed      *int64
+}
+
+// SearchStats describes how much work a search did.
+type SearchStats struct {
+	NodesVisited int
+	Duration     time.Duration
+}
+
+// Result is what every Searcher returns, whatever its internal representation.
+// Complete is false when the search was cancelled before it finished, in
+// which case Paths holds whatever had been found by then.
+type Result struct {
+	Paths    []Path
+	Complete bool
+	Stats    SearchStats
+}
+
+// Searcher is implemented by every search algorithm. FindSingle returns at
+// most one recipe, FindMultiple at most q.MaxPaths distinct recipes. Both
+// must return promptly once ctx is done.
+type Searcher interface {
+	FindSingle(ctx context.Context, g *RecipeGraph, q Query) (Result, error)
+	FindMultiple(ctx context.Context, g *RecipeGraph, q Query) (Result, error)
+}
+
+var (
+	searchersMu sync.RWMutex
+	searchers   = make(map[string]Searcher)
+)
+
+// Register makes a Searcher available under name. It panics if the name is
+// already taken, so it is meant to be called from init functions.
+func Register(name string, s Searcher) {
+	searchersMu.Lock()
+	defer searchersMu.Unlock()
+
+	if _, dup := searchers[name]; dup {
+		panic("recipe: searcher registered twice: " + name)
+	}
+	searchers[name] = s
+}
+
+// Lookup returns the Searcher registered under name.
+func Lookup(name string) (Searcher, bool) {
+	searchersMu.RLock()
+	defer searchersMu.RUnlock()
+
+	s, ok := searchers[name]
+	return s, ok
+}
+
+// Algorithms returns the names of all registered searchers, sorted.
+func Algorithms() []string {
+	searchersMu.RLock()
+	defer searchersMu.RUnlock()
+
+	names := make([]string, 0, len(searchers))
+	for name := range searchers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// pathFromSteps turns the element -> ingredients map used by the
+// bidirectional searches into a Path, ordering the steps so every ingredient
+// is crafted before it is used.
+func pathFromSteps(target string, steps map[string][]string, basicElements map[string]bool) Path {
+	path := Path{Steps: []Step{}, FinalItem: target}
+	done := make(map[string]bool)
+
+	var visit func(elem string)
+	visit = func(elem string) {
+		if done[elem] || basicElements[elem] {
+			return
+		}
+		done[elem] = true // set before recursing so a cycle cannot loop forever
+
+		ing, ok := steps[elem]
+		if !ok || len(ing) != 2 {
+			return
+		}
+		visit(ing[0])
+		visit(ing[1])
+		path.Steps = append(path.Steps, Step{Ingredients: [2]string{ing[0], ing[1]}, Result: elem})
+	}
+	visit(target)
+
+	return path
+}
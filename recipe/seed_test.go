@@ -0,0 +1,83 @@
+package recipe
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+// TestSeededSearchIsReproducible checks what seeds are for: the same query
+// and seed give byte-identical output, for every algorithm.
+func TestSeededSearchIsReproducible(t *testing.T) {
+	g, err := LoadGraph("../recipes.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	seed := int64(42)
+	q := Query{Target: "Human", MaxPaths: 5, Seed: &seed}
+
+	for _, name := range Algorithms() {
+		t.Run(name, func(t *testing.T) {
+			s, _ := Lookup(name)
+			var first []byte
+			for run := range 3 {
+				res, err := s.FindMultiple(context.Background(), g, q)
+				if err != nil {
+					t.Fatal(err)
+				}
+				result := NewSearchResult(g, name, res)
+				result.Duration = "" // the one field allowed to differ, as in /api/search
+				out, err := json.Marshal(result)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if run == 0 {
+					first = out
+				} else if !bytes.Equal(out, first) {
+					t.Fatalf("run %d differs from run 0:\n%s\n%s", run, out, first)
+				}
+			}
+		})
+	}
+}
+
+// TestSeededTraceIsReproducible does the same with trace=true, which the API
+// only allows for single searches, traces included.
+func TestSeededTraceIsReproducible(t *testing.T) {
+	g, err := LoadGraph("../recipes.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	seed := int64(42)
+	q := Query{Target: "Human", MaxPaths: 1, Seed: &seed}
+
+	for _, name := range Algorithms() {
+		t.Run(name, func(t *testing.T) {
+			s, _ := Lookup(name)
+			var first []byte
+			for run := range 3 {
+				trace := NewTrace(DefaultTraceLimit)
+				res, err := s.FindSingle(WithTrace(context.Background(), trace), g, q)
+				if err != nil {
+					t.Fatal(err)
+				}
+				result := NewSearchResult(g, name, res)
+				result.Duration = ""
+				result.Trace, result.TraceTruncated = trace.Events(), trace.Truncated()
+				if len(result.Trace) == 0 {
+					t.Fatal("nothing was traced")
+				}
+				out, err := json.Marshal(result)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if run == 0 {
+					first = out
+				} else if !bytes.Equal(out, first) {
+					t.Fatalf("run %d differs from run 0", run)
+				}
+			}
+		})
+	}
+}
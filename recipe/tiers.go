@@ -0,0 +1,96 @@
+package recipe
+
+import (
+	"fmt"
+	"sort"
+)
+
+// TierSource says where the tiers used by the searches come from.
+type TierSource string
+
+const (
+	TierScraped  TierSource = "scraped"  // the tier in the dataset, e.g. from the wiki headings
+	TierComputed TierSource = "computed" // the minimum crafting depth, see ComputeTiers
+)
+
+// ParseTierSource checks the name of a tier source.
+func ParseTierSource(s string) (TierSource, error) {
+	switch source := TierSource(s); source {
+	case TierScraped, TierComputed:
+		return source, nil
+	}
+	return "", fmt.Errorf("unknown tier source %q (must be %s or %s)", s, TierScraped, TierComputed)
+}
+
+// ComputeTiers derives tiers from the recipes alone: the basics are tier 0
+// and every other element is its minimum crafting depth from them, over all
+// its recipes. Elements that cannot be crafted are left out.
+//
+// Under these tiers the cheapest recipe of every reachable element obeys the
+// tier rule, so no reachable element is lost to a missing or wrong tier.
+func ComputeTiers(elements []ElementData, basics []string) map[string]int {
+	starting := make(map[string]bool, len(basics))
+	for _, elem := range basics {
+		starting[elem] = true
+	}
+	// craftDepths only accepts a recipe once both ingredients are reached
+	all := func(string, []string) bool { return true }
+	return craftDepths(elements, starting, all)
+}
+
+// TierMismatch is an element whose dataset tier differs from its computed
+// one. Computed is nil if the element cannot be crafted at all.
+type TierMismatch struct {
+	Element  string `json:"element"`
+	Scraped  int    `json:"scraped"`
+	Computed *int   `json:"computed"`
+}
+
+// TierReport compares the dataset tiers with the computed ones.
+type TierReport struct {
+	Elements   int            `json:"elements"`
+	Matching   int            `json:"matching"`
+	Mismatches []TierMismatch `json:"mismatches"`
+}
+
+// CompareTiers lists the elements whose dataset tier is not their computed
+// tier, sorted by name.
+func CompareTiers(elements []ElementData, basics []string) *TierReport {
+	computed := ComputeTiers(elements, basics)
+	report := &TierReport{Elements: len(elements), Mismatches: []TierMismatch{}}
+	for _, e := range elements {
+		tier, ok := computed[e.Element]
+		if ok && tier == e.Tier {
+			report.Matching++
+			continue
+		}
+		mismatch := TierMismatch{Element: e.Element, Scraped: e.Tier}
+		if ok {
+			mismatch.Computed = &tier
+		}
+		report.Mismatches = append(report.Mismatches, mismatch)
+	}
+	sort.Slice(report.Mismatches, func(i, j int) bool {
+		return report.Mismatches[i].Element < report.Mismatches[j].Element
+	})
+	return report
+}
+
+// ApplyTiers returns elements with the tiers of source. With computed tiers,
+// elements that cannot be crafted keep their dataset tier; no search can
+// reach them either way. The input is not modified.
+func ApplyTiers(elements []ElementData, basics []string, source TierSource) []ElementData {
+	if source != TierComputed {
+		return elements
+	}
+
+	computed := ComputeTiers(elements, basics)
+	out := make([]ElementData, len(elements))
+	for i, e := range elements {
+		if tier, ok := computed[e.Element]; ok {
+			e.Tier = tier
+		}
+		out[i] = e
+	}
+	return out
+}
@@ -0,0 +1,69 @@
+package recipe
+
+// RecipeNode is one element in a nested recipe tree. Leaves are elements
+// the player starts with (basics or inventory) and have no Recipe. Cost is
+// the number of crafting steps in the subtree, counting repeats.
+type RecipeNode struct {
+	Element  string        `json:"element"`
+	Tier     int           `json:"tier"`
+	ImageURL string        `json:"image_url"`
+	Cost     int           `json:"cost"`
+	Recipe   []string      `json:"recipe,omitempty"`
+	Children []*RecipeNode `json:"children,omitempty"`
+}
+
+// BuildRecipeTree turns a flat Path into a RecipeNode tree rooted at
+// path.FinalItem. Each ingredient is resolved to the closest step before
+// the one that uses it, so an element crafted twice with different recipes
+// keeps both recipes in the tree.
+func BuildRecipeTree(g *RecipeGraph, path Path) *RecipeNode {
+	ancestors := make(map[string]bool)
+
+	var build func(elem string, before int) *RecipeNode
+	build = func(elem string, before int) *RecipeNode {
+		node := &RecipeNode{Element: elem, Tier: g.tierMap[elem]}
+		if data, ok := g.Element(elem); ok {
+			node.ImageURL = data.ImageURL
+		}
+
+		idx := findStep(path.Steps, elem, before, ancestors)
+		if idx < 0 {
+			return node
+		}
+
+		step := path.Steps[idx]
+		ancestors[elem] = true
+		node.Recipe = []string{step.Ingredients[0], step.Ingredients[1]}
+		node.Children = []*RecipeNode{
+			build(step.Ingredients[0], idx),
+			build(step.Ingredients[1], idx),
+		}
+		node.Cost = 1 + node.Children[0].Cost + node.Children[1].Cost
+		delete(ancestors, elem)
+
+		return node
+	}
+
+	return build(path.FinalItem, len(path.Steps))
+}
+
+// findStep returns the index of the step that crafts elem, preferring the
+// last one before index before. Some algorithms list a step after its first
+// use, so it falls back to a later step as long as that cannot loop back to
+// an element already being built.
+func findStep(steps []Step, elem string, before int, ancestors map[string]bool) int {
+	if ancestors[elem] {
+		return -1
+	}
+	for i := before - 1; i >= 0; i-- {
+		if steps[i].Result == elem {
+			return i
+		}
+	}
+	for i := before; i < len(steps); i++ {
+		if steps[i].Result == elem && !ancestors[steps[i].Ingredients[0]] && !ancestors[steps[i].Ingredients[1]] {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,197 @@
+package recipe
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ErrInvalidDataset is returned by Report.Err when validation found errors.
+var ErrInvalidDataset = errors.New("invalid dataset")
+
+// Severity says whether an Issue makes a dataset unusable.
+type Severity string
+
+const (
+	SeverityError   Severity = "error"   // the data is broken, e.g. the scraper misparsed the page
+	SeverityWarning Severity = "warning" // the data loads, but some of it will never be used
+)
+
+// Issue codes reported by Validate.
+const (
+	IssueEmptyDataset      = "empty_dataset"
+	IssueEmptyName         = "empty_name"
+	IssueDuplicateElement  = "duplicate_element"
+	IssueMissingTier       = "missing_tier" // non-basic element left at the default tier 0
+	IssueNegativeTier      = "negative_tier"
+	IssueMalformedRecipe   = "malformed_recipe" // not exactly two non-empty ingredients
+	IssueMissingBasic      = "missing_basic"
+	IssueNoRecipes         = "no_recipes"
+	IssueMissingImage      = "missing_image"
+	IssueDuplicateRecipe   = "duplicate_recipe"
+	IssueUnknownIngredient = "unknown_ingredient"
+	IssueTierRule          = "tier_rule" // recipe the searches skip: an ingredient is not of a lower tier
+	IssueUnreachable       = "unreachable"
+)
+
+// Issue is one problem found by Validate. Recipe is set for problems with a
+// single recipe of Element.
+type Issue struct {
+	Severity Severity `json:"severity"`
+	Code     string   `json:"code"`
+	Element  string   `json:"element,omitempty"`
+	Recipe   []string `json:"recipe,omitempty"`
+	Message  string   `json:"message"`
+}
+
+// Report is the outcome of Validate. Summary counts the issues by code.
+type Report struct {
+	Elements int            `json:"elements"`
+	Valid    bool           `json:"valid"`
+	Errors   []Issue        `json:"errors"`
+	Warnings []Issue        `json:"warnings"`
+	Summary  map[string]int `json:"summary"`
+}
+
+func (r *Report) add(severity Severity, code, element string, recipe []string, format string, args ...any) {
+	issue := Issue{Severity: severity, Code: code, Element: element, Recipe: recipe, Message: fmt.Sprintf(format, args...)}
+	if severity == SeverityError {
+		r.Errors = append(r.Errors, issue)
+		r.Valid = false
+	} else {
+		r.Warnings = append(r.Warnings, issue)
+	}
+	r.Summary[code]++
+}
+
+// Err returns nil for a valid dataset, and otherwise an error wrapping
+// ErrInvalidDataset that quotes the first few errors.
+func (r *Report) Err() error {
+	if r.Valid {
+		return nil
+	}
+	const quoted = 3
+	msgs := make([]string, 0, quoted)
+	for _, issue := range r.Errors[:min(quoted, len(r.Errors))] {
+		msgs = append(msgs, issue.Message)
+	}
+	more := ""
+	if len(r.Errors) > quoted {
+		more = fmt.Sprintf(" (and %d more)", len(r.Errors)-quoted)
+	}
+	return fmt.Errorf("%w: %d errors: %s%s", ErrInvalidDataset, len(r.Errors), strings.Join(msgs, "; "), more)
+}
+
+// Validate checks a dataset before it is used to build a RecipeGraph.
+// Errors are data the graph cannot represent faithfully: missing or
+// duplicate names, tiers the scraper failed to assign and malformed recipes.
+// Warnings are data that loads but that no search will use, such as
+// ingredients that are not elements, recipes breaking the tier rule and
+// elements that cannot be crafted from the basics.
+//
+// basicElements are the starting elements of the game, DefaultBasicElements
+// if none are given.
+func Validate(elements []ElementData, basicElements ...string) *Report {
+	if len(basicElements) == 0 {
+		basicElements = DefaultBasicElements
+	}
+	r := &Report{
+		Elements: len(elements),
+		Valid:    true,
+		Errors:   []Issue{},
+		Warnings: []Issue{},
+		Summary:  make(map[string]int),
+	}
+	if len(elements) == 0 {
+		r.add(SeverityError, IssueEmptyDataset, "", nil, "dataset has no elements")
+		return r
+	}
+
+	basics := make(map[string]bool, len(basicElements))
+	for _, elem := range basicElements {
+		basics[elem] = true
+	}
+
+	seen := make(map[string]bool, len(elements))
+	for i, e := range elements {
+		switch {
+		case strings.TrimSpace(e.Element) == "":
+			r.add(SeverityError, IssueEmptyName, "", nil, "element #%d has no name", i+1)
+		case seen[e.Element]:
+			r.add(SeverityError, IssueDuplicateElement, e.Element, nil, "%s is listed more than once", e.Element)
+		}
+		seen[e.Element] = true
+
+		switch {
+		case e.Tier < 0:
+			r.add(SeverityError, IssueNegativeTier, e.Element, nil, "%s has negative tier %d", e.Element, e.Tier)
+		case e.Tier == 0 && !basics[e.Element]:
+			r.add(SeverityError, IssueMissingTier, e.Element, nil, "%s is not a basic element but has tier 0", e.Element)
+		}
+
+		if e.ImageURL == "" {
+			r.add(SeverityWarning, IssueMissingImage, e.Element, nil, "%s has no image", e.Element)
+		}
+		if len(e.Recipes) == 0 && !basics[e.Element] {
+			r.add(SeverityWarning, IssueNoRecipes, e.Element, nil, "%s has no recipes", e.Element)
+		}
+	}
+	for _, elem := range basicElements {
+		if !seen[elem] {
+			r.add(SeverityWarning, IssueMissingBasic, elem, nil, "basic element %s is missing", elem)
+		}
+	}
+
+	g := NewRecipeGraph(elements, basicElements...)
+	for _, e := range elements {
+		combos := make(map[[2]string]bool, len(e.Recipes))
+		for _, combo := range e.Recipes {
+			if len(combo) != 2 || strings.TrimSpace(combo[0]) == "" || strings.TrimSpace(combo[1]) == "" {
+				r.add(SeverityError, IssueMalformedRecipe, e.Element, combo, "%s has a recipe that is not two ingredients: %q", e.Element, combo)
+				continue
+			}
+
+			key := recipeKey(combo[0], combo[1])
+			if combos[key] {
+				r.add(SeverityWarning, IssueDuplicateRecipe, e.Element, combo, "%s lists %s + %s twice", e.Element, combo[0], combo[1])
+				continue
+			}
+			combos[key] = true
+
+			unknown := false
+			for _, ing := range uniqueIngredients(combo) {
+				if !g.Has(ing) {
+					r.add(SeverityWarning, IssueUnknownIngredient, e.Element, combo, "%s uses %s, which is not an element", e.Element, ing)
+					unknown = true
+				}
+			}
+			// basics are never crafted, so their recipes cannot break anything
+			if !unknown && !basics[e.Element] && !g.validRecipe(e.Element, combo) {
+				r.add(SeverityWarning, IssueTierRule, e.Element, combo, "%s (tier %d) = %s (tier %d) + %s (tier %d) breaks the tier rule",
+					e.Element, g.tierMap[e.Element], combo[0], g.tierMap[combo[0]], combo[1], g.tierMap[combo[1]])
+			}
+		}
+	}
+
+	var unreachable []string
+	for elem := range seen {
+		if _, ok := g.Depth(elem); !ok && !basics[elem] && len(g.recipeMap[elem]) > 0 {
+			unreachable = append(unreachable, elem)
+		}
+	}
+	sort.Strings(unreachable)
+	for _, elem := range unreachable {
+		r.add(SeverityWarning, IssueUnreachable, elem, nil, "%s cannot be crafted from the basic elements", elem)
+	}
+
+	return r
+}
+
+// uniqueIngredients returns the ingredients of combo, A+A giving just A.
+func uniqueIngredients(combo []string) []string {
+	if combo[0] == combo[1] {
+		return combo[:1]
+	}
+	return combo
+}
@@ -0,0 +1,112 @@
+package recipe
+
+import (
+	"errors"
+	"testing"
+)
+
+// basicData is the four default basics, valid on their own.
+func basicData() []ElementData {
+	return []ElementData{
+		{Element: "Air", ImageURL: "air.png"},
+		{Element: "Earth", ImageURL: "earth.png"},
+		{Element: "Fire", ImageURL: "fire.png"},
+		{Element: "Water", ImageURL: "water.png"},
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		extra    []ElementData
+		errors   map[string]int
+		warnings map[string]int
+	}{
+		{
+			name:  "valid",
+			extra: []ElementData{{Element: "Mud", Tier: 1, ImageURL: "mud.png", Recipes: [][]string{{"Earth", "Water"}}}},
+		},
+		{
+			name:   "empty and duplicate names",
+			extra:  []ElementData{{Element: " ", Tier: 1}, {Element: "Air"}},
+			errors: map[string]int{IssueEmptyName: 1, IssueDuplicateElement: 1},
+			// neither has an image, and the empty name has no recipes
+			warnings: map[string]int{IssueNoRecipes: 1, IssueMissingImage: 2},
+		},
+		{
+			name: "missing and negative tiers",
+			extra: []ElementData{
+				{Element: "Mud", ImageURL: "mud.png", Recipes: [][]string{{"Earth", "Water"}}},
+				{Element: "Steam", Tier: -1, ImageURL: "steam.png", Recipes: [][]string{{"Fire", "Water"}}},
+			},
+			errors: map[string]int{IssueMissingTier: 1, IssueNegativeTier: 1},
+			// neither can be crafted: no ingredient has a lower tier
+			warnings: map[string]int{IssueTierRule: 2, IssueUnreachable: 2},
+		},
+		{
+			name:   "malformed recipe",
+			extra:  []ElementData{{Element: "Mud", Tier: 1, ImageURL: "mud.png", Recipes: [][]string{{"Earth", "Water"}, {"Earth"}, {"Earth", ""}}}},
+			errors: map[string]int{IssueMalformedRecipe: 2},
+		},
+		{
+			name: "unused data",
+			extra: []ElementData{
+				{Element: "Mud", Tier: 1, Recipes: [][]string{{"Earth", "Water"}, {"Water", "Earth"}, {"Earth", "Clay"}}},
+				{Element: "Lava", Tier: 1, ImageURL: "lava.png", Recipes: [][]string{{"Earth", "Mud"}}},
+				{Element: "Golem", Tier: 5, ImageURL: "golem.png"},
+			},
+			warnings: map[string]int{
+				IssueMissingImage:      1, // Mud
+				IssueDuplicateRecipe:   1, // Water + Earth
+				IssueUnknownIngredient: 1, // Clay
+				IssueTierRule:          1, // Mud is not below Lava
+				IssueUnreachable:       1, // Lava
+				IssueNoRecipes:         1, // Golem
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := Validate(append(basicData(), tt.extra...))
+			checkIssueCodes(t, "errors", report.Errors, tt.errors)
+			checkIssueCodes(t, "warnings", report.Warnings, tt.warnings)
+
+			if report.Valid != (len(tt.errors) == 0) {
+				t.Errorf("Valid = %v with errors %v", report.Valid, tt.errors)
+			}
+			if err := report.Err(); (err == nil) != report.Valid || (err != nil && !errors.Is(err, ErrInvalidDataset)) {
+				t.Errorf("Err() = %v for Valid = %v", err, report.Valid)
+			}
+		})
+	}
+}
+
+func TestValidateBasics(t *testing.T) {
+	if report := Validate(nil); report.Valid || report.Summary[IssueEmptyDataset] != 1 {
+		t.Errorf("an empty dataset is not reported: %+v", report)
+	}
+
+	// with other basics, the defaults are ordinary elements
+	elements := []ElementData{{Element: "Sun", ImageURL: "sun.png"}, {Element: "Air", ImageURL: "air.png"}}
+	report := Validate(elements, "Sun", "Moon")
+	checkIssueCodes(t, "errors", report.Errors, map[string]int{IssueMissingTier: 1})
+	checkIssueCodes(t, "warnings", report.Warnings, map[string]int{IssueMissingBasic: 1, IssueNoRecipes: 1})
+}
+
+func checkIssueCodes(t *testing.T, kind string, issues []Issue, want map[string]int) {
+	t.Helper()
+	got := make(map[string]int)
+	for _, issue := range issues {
+		got[issue.Code]++
+	}
+	if len(got) != len(want) {
+		t.Errorf("%s = %v, want %v", kind, got, want)
+		return
+	}
+	for code, n := range want {
+		if got[code] != n {
+			t.Errorf("%s = %v, want %v", kind, got, want)
+			return
+		}
+	}
+}
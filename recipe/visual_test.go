@@ -0,0 +1,30 @@
+package recipe
+
+import (
+	"context"
+	"testing"
+)
+
+// TestConcurrentSearchesDoNotTrace checks that multiple searches running
+// attempts concurrently leave a trace alone instead of interleaving it.
+func TestConcurrentSearchesDoNotTrace(t *testing.T) {
+	g, err := LoadGraph("../recipes.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	seed := int64(42)
+	q := Query{Target: "Human", MaxPaths: 3, Seed: &seed}
+
+	for _, name := range []string{"bfs", "dfs", "bidirectional-bfs", "bidirectional-dfs"} {
+		t.Run(name, func(t *testing.T) {
+			s, _ := Lookup(name)
+			trace := NewTrace(DefaultTraceLimit)
+			if _, err := s.FindMultiple(WithTrace(context.Background(), trace), g, q); err != nil {
+				t.Fatal(err)
+			}
+			if n := len(trace.Events()); n != 0 {
+				t.Errorf("recorded %d events", n)
+			}
+		})
+	}
+}
@@ -3,9 +3,9 @@ package recipe
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
-	"log"
 	"math/rand"
 	"slices"
 	"sort"
@@ -25,68 +25,113 @@ type ElementData struct {
 type SearchResult struct {
 	Paths        [][]string            `json:"paths"`
 	Steps        []map[string][]string `json:"steps"`
+	Trees        []*RecipeNode         `json:"trees"`
 	NodesVisited int                   `json:"nodes_visited"`
-	Duration     string                `json:"duration"`
+	Duration     string                `json:"duration,omitempty"`
 	Algorithm    string                `json:"algorithm"`
+	Complete     bool                  `json:"complete"`
+	Seed         *int64                `json:"seed,omitempty"`
+
+	// only filled in when a trace was requested
+	Trace          []TraceEvent `json:"trace,omitempty"`
+	TraceTruncated bool         `json:"trace_truncated,omitempty"`
+}
+
+// NewSearchResult converts a Searcher's Result into the JSON shape served by
+// /api/search. Steps is kept for older clients; Trees is the lossless form.
+func NewSearchResult(g *RecipeGraph, algorithm string, res Result) SearchResult {
+	result := SearchResult{
+		Paths:        [][]string{},
+		Steps:        []map[string][]string{},
+		Trees:        []*RecipeNode{},
+		NodesVisited: res.Stats.NodesVisited,
+		Duration:     res.Stats.Duration.String(),
+		Algorithm:    algorithm,
+		Complete:     res.Complete,
+	}
+	for _, p := range res.Paths {
+		pathList := []string{}
+		stepMap := make(map[string][]string)
+		for _, s := range p.Steps {
+			pathList = append(pathList, s.Result)
+			stepMap[s.Result] = []string{s.Ingredients[0], s.Ingredients[1]}
+		}
+		result.Paths = append(result.Paths, pathList)
+		result.Steps = append(result.Steps, stepMap)
+		result.Trees = append(result.Trees, BuildRecipeTree(g, p))
+	}
+	return result
 }
 
 func FindSingleRecipeBi(
+	ctx context.Context,
+	g *RecipeGraph,
 	target string,
-	elements map[string][][]string,
-	basicElements map[string]bool,
+	basicElements map[string]bool, // starting inventory, usually g.BasicElements()
 	algorithm string, // "bfs", "dfs", "bidirectional"
-	tierMap map[string]int,
 	bidiStrategy ...string, // optional: ["dfs"] or ["bfs"] if bidirectional
-) ([]string, map[string][]string, int, time.Duration) {
-	if algorithm == "bidirectional" {
-		if len(bidiStrategy) == 0 {
-			return nil, nil, 0, 0
-		}
-		strategy := bidiStrategy[0]
-		switch strategy {
-		case "dfs":
-			return BiSearchDFS(target, elements, basicElements, tierMap)
-		case "bfs":
-			return BiSearchBFS(target, elements, basicElements, tierMap)
-		default:
-			return nil, nil, 0, 0
-		}
-	} else if algorithm == "dfs" {
-		return BiSearchDFS(target, elements, basicElements, tierMap)
-	} else if algorithm == "bfs" {
-		return BiSearchBFS(target, elements, basicElements, tierMap)
+) ([]string, map[string][]string, int, time.Duration, error) {
+	strategy, err := biStrategy(algorithm, bidiStrategy)
+	if err != nil {
+		return nil, nil, 0, 0, err
+	}
+	if err := checkTarget(g, target, basicElements[target]); err != nil {
+		return nil, nil, 0, 0, err
 	}
-	return nil, nil, 0, 0
+
+	elements, tierMap := g.RecipeMap(), g.TierMap()
+	search := BiSearchBFS
+	if strategy == "dfs" {
+		search = BiSearchDFS
+	}
+	path, steps, visited, duration := search(ctx, target, elements, basicElements, tierMap)
+	if path == nil {
+		return nil, nil, visited, duration, searchError(ctx, target, 0)
+	}
+	return path, steps, visited, duration, nil
 }
 
 func FindMultipleRecipesBi(
+	ctx context.Context,
+	g *RecipeGraph,
 	target string,
-	elements map[string][][]string,
-	basicElements map[string]bool,
+	basicElements map[string]bool, // starting inventory, usually g.BasicElements()
 	algorithm string, // "bfs", "dfs", "bidirectional"
 	maxPaths int,
-	tierMap map[string]int,
+	seed *int64, // nil: fastest, results may vary between calls
 	bidiStrategy ...string, // optional
-) ([][]string, []map[string][]string, int, time.Duration) {
+) ([][]string, []map[string][]string, int, time.Duration, error) {
+	strategy, err := biStrategy(algorithm, bidiStrategy)
+	if err != nil {
+		return nil, nil, 0, 0, err
+	}
+	if err := checkTarget(g, target, basicElements[target]); err != nil {
+		return nil, nil, 0, 0, err
+	}
+
+	elements, tierMap := g.RecipeMap(), g.TierMap()
+	search := BiSearchMultipleBFS
+	if strategy == "dfs" {
+		search = BiSearchMultipleDFS
+	}
+	paths, steps, visited, duration := search(ctx, target, elements, basicElements, maxPaths, tierMap, seed)
+	return paths, steps, visited, duration, searchError(ctx, target, len(paths))
+}
+
+// biStrategy resolves the algorithm/bidiStrategy pair accepted by the
+// bidirectional wrappers to "bfs" or "dfs".
+func biStrategy(algorithm string, bidiStrategy []string) (string, error) {
+	strategy := algorithm
 	if algorithm == "bidirectional" {
 		if len(bidiStrategy) == 0 {
-			return nil, nil, 0, 0
+			return "", errors.New("recipe: bidirectional search needs a bfs or dfs strategy")
 		}
-		strategy := bidiStrategy[0]
-		switch strategy {
-		case "dfs":
-			return BiSearchMultipleDFS(target, elements, basicElements, maxPaths, tierMap)
-		case "bfs":
-			return BiSearchMultipleBFS(target, elements, basicElements, maxPaths, tierMap)
-		default:
-			return nil, nil, 0, 0
-		}
-	} else if algorithm == "dfs" {
-		return BiSearchMultipleDFS(target, elements, basicElements, maxPaths, tierMap)
-	} else if algorithm == "bfs" {
-		return BiSearchMultipleBFS(target, elements, basicElements, maxPaths, tierMap)
+		strategy = bidiStrategy[0]
+	}
+	if strategy != "bfs" && strategy != "dfs" {
+		return "", fmt.Errorf("recipe: unknown bidirectional strategy %q", strategy)
 	}
-	return nil, nil, 0, 0
+	return strategy, nil
 }
 
 func LoadElements(filename string) ([]ElementData, error) {
@@ -102,14 +147,21 @@ func LoadElements(filename string) ([]ElementData, error) {
 	return elements, nil
 }
 
-func PrepareElementMaps(elements []ElementData) (map[string][][]string, map[string]int, map[string]bool) {
+// DefaultBasicElements are the elements every Little Alchemy 2 player starts with.
+var DefaultBasicElements = []string{"Air", "Earth", "Fire", "Water"}
+
+// PrepareElementMaps indexes elements by name. basics are the elements
+// every player starts with, DefaultBasicElements if none are given; they are
+// always tier 0.
+func PrepareElementMaps(elements []ElementData, basics ...string) (map[string][][]string, map[string]int, map[string]bool) {
+	if len(basics) == 0 {
+		basics = DefaultBasicElements
+	}
 	recipeMap := make(map[string][][]string)
 	tierMap := make(map[string]int)
-	basicElements := map[string]bool{
-		"Air":   true,
-		"Earth": true,
-		"Fire":  true,
-		"Water": true,
+	basicElements := make(map[string]bool)
+	for _, elem := range basics {
+		basicElements[elem] = true
 	}
 	for _, elem := range elements {
 		recipeMap[elem.Element] = elem.Recipes
@@ -121,7 +173,34 @@ func PrepareElementMaps(elements []ElementData) (map[string][][]string, map[stri
 	return recipeMap, tierMap, basicElements
 }
 
-func BiSearchMultipleBFS(target string, elements map[string][][]string, basicElements map[string]bool, maxPaths int, tierMap map[string]int) ([][]string, []map[string][]string, int, time.Duration) {
+// attemptSeed is the shuffle seed of one attempt of a multiple recipe
+// search. Without a seed the attempt number is used, as before seeds existed.
+func attemptSeed(seed *int64, attempt int) int64 {
+	if seed == nil {
+		return int64(attempt)
+	}
+	return *seed*1_000_003 + int64(attempt)
+}
+
+// searchHit is a path found by one worker of a concurrent search. order is
+// the position of the work that produced it; with a seed, hits are sorted on
+// it before de-duplication so the outcome does not depend on scheduling.
+type searchHit struct {
+	path    Path
+	visited int
+	order   [2]int
+}
+
+func sortHits(hits []searchHit) {
+	sort.SliceStable(hits, func(i, j int) bool {
+		if hits[i].order[0] != hits[j].order[0] {
+			return hits[i].order[0] < hits[j].order[0]
+		}
+		return hits[i].order[1] < hits[j].order[1]
+	})
+}
+
+func BiSearchMultipleBFS(ctx context.Context, target string, elements map[string][][]string, basicElements map[string]bool, maxPaths int, tierMap map[string]int, seed *int64) ([][]string, []map[string][]string, int, time.Duration) {
 	var (
 		paths          [][]string
 		allSteps       []map[string][]string
@@ -135,11 +214,13 @@ func BiSearchMultipleBFS(target string, elements map[string][][]string, basicEle
 	fmt.Println("Finding up to", maxPaths, "different paths for", target)
 
 	var wg sync.WaitGroup
-	resultChan := make(chan struct {
-		path  []string
-		steps map[string][]string
-		nodes int
-	}, maxPaths*3) // Memperbesar buffer channel agar tidak blocking
+	type attemptResult struct {
+		path    []string
+		steps   map[string][]string
+		nodes   int
+		attempt int
+	}
+	resultChan := make(chan attemptResult, maxPaths*3) // Memperbesar buffer channel agar tidak blocking
 
 	// Membatasi percobaan
 	attemptsToRun := maxPaths * 3
@@ -150,19 +231,30 @@ func BiSearchMultipleBFS(target string, elements map[string][][]string, basicEle
 	// Atomic untuk mengontrol apakah sudah cukup path
 	var foundEnoughPaths int32
 
+	// dibatalkan kalau attempt sisanya tidak akan mengubah hasil
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
 	for attempt := 0; attempt < attemptsToRun; attempt++ {
 		wg.Add(1)
 		go func(attemptNum int) {
 			defer wg.Done()
 
-			// Cek apakah sudah cukup path unik
-			if atomic.LoadInt32(&foundEnoughPaths) > 0 {
+			// Cek apakah sudah cukup path unik atau pencarian dibatalkan
+			if atomic.LoadInt32(&foundEnoughPaths) > 0 || ctx.Err() != nil {
 				return
 			}
 
 			elementsCopy := copyElements(elements)
-			shuffleRecipes(elementsCopy, attemptNum)
-			path, steps, nodes, _ := BiSearchBFS(target, elementsCopy, basicElements, tierMap)
+			shuffleRecipes(elementsCopy, attemptSeed(seed, attemptNum))
+			path, steps, nodes, _ := BiSearchBFS(ctx, target, elementsCopy, basicElements, tierMap)
+
+			// dengan seed, semua attempt dilaporkan (termasuk yang gagal)
+			// dan disaring berurutan oleh pembaca
+			if seed != nil {
+				resultChan <- attemptResult{path, steps, nodes, attemptNum}
+				return
+			}
 
 			// Selalu tambahkan jumlah nodes yang dieksplorasi, berhasil atau tidak
 			atomic.AddInt64(&totalNodesAtomic, int64(nodes))
@@ -182,11 +274,7 @@ func BiSearchMultipleBFS(target string, elements map[string][][]string, basicEle
 
 			// Jika bukan duplikat dan masih butuh path, kirim hasilnya
 			if !isDuplicate && len(pathSignatures) <= maxPaths {
-				resultChan <- struct {
-					path  []string
-					steps map[string][]string
-					nodes int
-				}{path, steps, nodes}
+				resultChan <- attemptResult{path, steps, nodes, attemptNum}
 
 				// Jika sudah cukup path, set flag
 				pathMutex.Lock()
@@ -203,13 +291,41 @@ func BiSearchMultipleBFS(target string, elements map[string][][]string, basicEle
 		close(resultChan)
 	}()
 
-	for result := range resultChan {
-		// Path yang dikirim sudah diverifikasi unik, jadi langsung tambahkan
-		paths = append(paths, result.path)
-		allSteps = append(allSteps, result.steps)
+	if seed != nil {
+		// Hasil diambil urut per attempt. Begitu attempt 0..next-1 sudah
+		// memberi cukup path unik, attempt berikutnya tidak berpengaruh lagi
+		// dan boleh dibatalkan, jadi hasilnya tidak tergantung penjadwalan.
+		results := make([]*attemptResult, attemptsToRun)
+		next := 0
+		for result := range resultChan {
+			results[result.attempt] = &result
+			for next < attemptsToRun && results[next] != nil && len(paths) < maxPaths {
+				r := results[next]
+				next++
+				atomic.AddInt64(&totalNodesAtomic, int64(r.nodes))
+				if r.path == nil {
+					continue
+				}
+				if signature := hashPath(r.path); !pathSignatures[signature] {
+					pathSignatures[signature] = true
+					paths = append(paths, r.path)
+					allSteps = append(allSteps, r.steps)
+				}
+			}
+			if len(paths) >= maxPaths {
+				cancel()
+				break
+			}
+		}
+	} else {
+		for result := range resultChan {
+			// Path yang dikirim sudah diverifikasi unik, jadi langsung tambahkan
+			paths = append(paths, result.path)
+			allSteps = append(allSteps, result.steps)
 
-		if len(paths) >= maxPaths {
-			break
+			if len(paths) >= maxPaths {
+				break
+			}
 		}
 	}
 
@@ -242,7 +358,7 @@ func hashPath(path []string) string {
 	return b.String()
 }
 
-func BiSearchMultipleDFS(target string, elements map[string][][]string, basicElements map[string]bool, maxPaths int, tierMap map[string]int) ([][]string, []map[string][]string, int, time.Duration) {
+func BiSearchMultipleDFS(ctx context.Context, target string, elements map[string][][]string, basicElements map[string]bool, maxPaths int, tierMap map[string]int, seed *int64) ([][]string, []map[string][]string, int, time.Duration) {
 	var (
 		paths          [][]string
 		allSteps       []map[string][]string
@@ -254,23 +370,14 @@ func BiSearchMultipleDFS(target string, elements map[string][][]string, basicEle
 	fmt.Println("Finding up to", maxPaths, "different paths for", target)
 
 	for attempt := 0; attempt < maxPaths*3; attempt++ {
-		if len(paths) >= maxPaths {
+		if len(paths) >= maxPaths || ctx.Err() != nil {
 			break
 		}
 
 		elementsCopy := copyElements(elements)
-		shuffleRecipes(elementsCopy, attempt)
+		shuffleRecipes(elementsCopy, attemptSeed(seed, attempt))
 
-		var p []string
-		var s map[string][]string
-		var n int
-
-		done := make(chan bool)
-		go func() {
-			p, s, n, _ = BiSearchDFS(target, elementsCopy, basicElements, tierMap)
-			done <- true
-		}()
-		<-done
+		p, s, n, _ := BiSearchDFS(ctx, target, elementsCopy, basicElements, tierMap)
 
 		if p == nil {
 			continue
@@ -346,26 +453,16 @@ func generateSignature(path Path) string {
 	return signature
 }
 
-func FindSingleRecipeDFS(recipesFile, targetElement string, startingElements []string) (*Path, int, time.Duration) {
-	recipes, err := LoadRecipes(recipesFile)
-
-	for _, elem := range startingElements {
-		if elem == targetElement {
-			fmt.Printf("Target element '%s' is already in starting elements\n", targetElement)
-			return nil, 0, 0
-		}
-	}
-
-	if err != nil {
-		log.Fatalf("Error loading recipes: %v", err)
-		return nil, 0, 0
+func FindSingleRecipeDFS(ctx context.Context, g *RecipeGraph, targetElement string, startingElements []string) (*Path, int, time.Duration, error) {
+	if err := checkTarget(g, targetElement, isBasicElement(targetElement, startingElements)); err != nil {
+		return nil, 0, 0, err
 	}
+	recipes := g.records
 
-	paths, duration, visited := findPathDFS(recipes, startingElements, targetElement)
+	paths, duration, visited := findPathDFS(ctx, recipes, startingElements, targetElement)
 
 	if len(paths) == 0 {
-		fmt.Printf("No path found to create '%s'\n", targetElement)
-		return nil, 0, duration
+		return nil, visited, duration, searchError(ctx, targetElement, 0)
 	}
 
 	path := paths[0]
@@ -377,43 +474,25 @@ func FindSingleRecipeDFS(recipesFile, targetElement string, startingElements []s
 	fmt.Printf("Time taken to search: %v\n", duration)
 	fmt.Printf("Nodes visited: %d\n", visited)
 
-	return &path, visited, duration
+	return &path, visited, duration, nil
 }
 
-func FindMultipleRecipesDFSConcurrent(recipesFile, targetElement string, startingElements []string, maxRecipes int) ([]Path, int, time.Duration) {
-	recipes, err := LoadRecipes(recipesFile)
-
-	for _, elem := range startingElements {
-		if elem == targetElement {
-			fmt.Printf("Target element '%s' is already in starting elements\n", targetElement)
-			return nil, 0, 0
-		}
-	}
-
-	if err != nil {
-		log.Fatalf("Error loading recipes: %v", err)
-		return nil, 0, 0
-	}
-
-	// Check if target exists
-	found := false
-	for _, r := range recipes {
-		if r.Element == targetElement {
-			found = true
-			break
-		}
-	}
-	if !found {
-		fmt.Printf("Target element '%s' not found in recipes\n", targetElement)
-		return nil, 0, 0
+func FindMultipleRecipesDFSConcurrent(ctx context.Context, g *RecipeGraph, targetElement string, startingElements []string, maxRecipes int, seed *int64) ([]Path, int, time.Duration, error) {
+	if err := checkTarget(g, targetElement, isBasicElement(targetElement, startingElements)); err != nil {
+		return nil, 0, 0, err
 	}
+	recipes := g.records
 
 	// create recipe variations
 	variations := make([][]ElementRecipe, maxRecipes*5)
 	variations[0] = make([]ElementRecipe, len(recipes))
 	copy(variations[0], recipes)
 	for i := 1; i < len(variations); i++ {
-		variations[i] = createRecipeVariation(recipes, i)
+		if ctx.Err() != nil {
+			variations = variations[:i]
+			break
+		}
+		variations[i] = createRecipeVariation(recipes, attemptSeed(seed, i))
 	}
 
 	var (
@@ -425,29 +504,38 @@ func FindMultipleRecipesDFSConcurrent(recipesFile, targetElement string, startin
 		startTime      = time.Now()
 	)
 
-	resultChan := make(chan struct { // utk kirim hasil antar goroutine
-		path    Path
-		visited int
-		varIdx  int
-	}, len(variations))
+	resultChan := make(chan searchHit, len(variations)) // utk kirim hasil antar goroutine
 
 	const maxConcurrent = 5
 	sem := make(chan struct{}, maxConcurrent) // manual semaphore
 
+	accept := func(hit searchHit) {
+		sig := generateSignature(hit.path)
+		if !pathSignatures[sig] && len(allPaths) < maxRecipes {
+			pathSignatures[sig] = true
+			allPaths = append(allPaths, hit.path)
+			totalVisited += hit.visited
+		}
+	}
+
+	// dengan seed, hasil baru disaring setelah semua variasi selesai
+	var hits []searchHit
+	collected := make(chan struct{}) // ditutup setelah semua hasil diproses
 	go func() {
-		for result := range resultChan {
+		defer close(collected)
+		for hit := range resultChan {
 			mu.Lock()
-			sig := generateSignature(result.path)
-			if !pathSignatures[sig] && len(allPaths) < maxRecipes {
-				pathSignatures[sig] = true
-				allPaths = append(allPaths, result.path)
-				totalVisited += result.visited
+			if seed != nil {
+				hits = append(hits, hit)
+			} else {
+				accept(hit)
 			}
 			mu.Unlock()
 		}
 	}()
 
 	// loop all variation parallelly
+loop:
 	for varIdx, recipeVariation := range variations {
 		mu.Lock()
 		if len(allPaths) >= maxRecipes {
@@ -456,51 +544,46 @@ func FindMultipleRecipesDFSConcurrent(recipesFile, targetElement string, startin
 		}
 		mu.Unlock()
 
+		select {
+		case sem <- struct{}{}: // masuk ke semaphore
+		case <-ctx.Done():
+			break loop
+		}
 		wg.Add(1)
-		sem <- struct{}{} // masuk ke semaphore
 		go func(recipes []ElementRecipe, idx int) {
 			defer wg.Done()
 			defer func() { <-sem }()
 
-			type localResult struct {
-				paths   []Path
-				visited int
-			}
-
-			innerChan := make(chan localResult, 1) // jalankin dfs dlam goroutine
-			go func() {
-				paths, _, visited := findPathDFS(recipes, startingElements, targetElement)
-				innerChan <- localResult{paths, visited}
-			}()
-
-			result := <-innerChan // masukkin ke result channel utama
-			if len(result.paths) > 0 {
-				resultChan <- struct {
-					path    Path
-					visited int
-					varIdx  int
-				}{result.paths[0], result.visited, idx}
+			paths, _, visited := findPathDFS(ctx, recipes, startingElements, targetElement)
+			if len(paths) > 0 {
+				resultChan <- searchHit{paths[0], visited, [2]int{idx, 0}}
 			}
 		}(recipeVariation, varIdx)
 	}
 
 	wg.Wait()
 	close(resultChan)
+	<-collected
+
+	sortHits(hits)
+	for _, hit := range hits {
+		accept(hit)
+	}
 
 	// urutin dari paling pendek
-	sort.Slice(allPaths, func(i, j int) bool {
+	sort.SliceStable(allPaths, func(i, j int) bool {
 		return len(allPaths[i].Steps) < len(allPaths[j].Steps)
 	})
 
 	duration := time.Since(startTime)
 
-	return allPaths, totalVisited, duration
+	return allPaths, totalVisited, duration, searchError(ctx, targetElement, len(allPaths))
 }
 
-func createRecipeVariation(recipes []ElementRecipe, seed int) []ElementRecipe {
+func createRecipeVariation(recipes []ElementRecipe, seed int64) []ElementRecipe {
 	variation := make([]ElementRecipe, len(recipes))
 
-	r := rand.New(rand.NewSource(int64(seed)))
+	r := rand.New(rand.NewSource(seed))
 
 	for i, recipe := range recipes {
 		recipeCopy := ElementRecipe{
@@ -535,29 +618,19 @@ func isBasicElement(element string, basicElements []string) bool {
 	return slices.Contains(basicElements, element)
 }
 
-func FindSingleRecipeBFS(recipesFile, targetElement string, startingElements []string) (*Path, int, time.Duration) {
-	recipes, err := LoadRecipes(recipesFile)
-
-	for _, elem := range startingElements {
-		if elem == targetElement {
-			fmt.Printf("Target element '%s' is already in starting elements\n", targetElement)
-			return nil, 0, 0
-		}
-	}
-
-	if err != nil {
-		log.Fatalf("Error loading recipes: %v", err)
-		return nil, 0, 0
+func FindSingleRecipeBFS(ctx context.Context, g *RecipeGraph, targetElement string, startingElements []string) (*Path, int, time.Duration, error) {
+	if err := checkTarget(g, targetElement, isBasicElement(targetElement, startingElements)); err != nil {
+		return nil, 0, 0, err
 	}
+	recipes := g.records
 
 	fmt.Printf("Loaded %d recipes\n", len(recipes))
 	fmt.Printf("Finding path to create: %s\n", targetElement)
 
-	paths, duration, visited := findPathBFS(recipes, startingElements, targetElement)
+	paths, duration, visited := findPathBFS(ctx, recipes, startingElements, targetElement)
 
 	if len(paths) == 0 {
-		fmt.Printf("No path found to create '%s'\n", targetElement)
-		return nil, 0, 0
+		return nil, visited, duration, searchError(ctx, targetElement, 0)
 	}
 
 	path := paths[0]
@@ -569,24 +642,15 @@ func FindSingleRecipeBFS(recipesFile, targetElement string, startingElements []s
 	fmt.Printf("⏱ Time taken to search: %v\n", duration)
 	fmt.Printf("📦 Nodes visited: %d\n", visited)
 
-	return &path, visited, duration
+	return &path, visited, duration, nil
 }
 
-func FindMultipleRecipesBFSConcurrent(recipesFile, targetElement string, startingElements []string, maxRecipes int) ([]Path, int, time.Duration) {
-	startTime := time.Now()
-	recipes, err := LoadRecipes(recipesFile)
-
-	for _, elem := range startingElements {
-		if elem == targetElement {
-			fmt.Printf("Target element '%s' is already in starting elements\n", targetElement)
-			return nil, 0, 0
-		}
-	}
-
-	if err != nil {
-		log.Fatalf("Error loading recipes: %v", err)
-		return nil, 0, 0
+func FindMultipleRecipesBFSConcurrent(ctx context.Context, g *RecipeGraph, targetElement string, startingElements []string, maxRecipes int, seed *int64) ([]Path, int, time.Duration, error) {
+	if err := checkTarget(g, targetElement, isBasicElement(targetElement, startingElements)); err != nil {
+		return nil, 0, 0, err
 	}
+	startTime := time.Now()
+	recipes := g.records
 
 	// Check if target exists and get its recipes
 	targetRecipes := make([][2]string, 0)
@@ -597,8 +661,7 @@ func FindMultipleRecipesBFSConcurrent(recipesFile, targetElement string, startin
 		}
 	}
 	if len(targetRecipes) == 0 {
-		fmt.Printf("Target element '%s' not found in recipes\n", targetElement)
-		return nil, 0, 0
+		return nil, 0, time.Since(startTime), searchError(ctx, targetElement, 0)
 	}
 
 	// Build recipe maps and hierarchies for faster lookups
@@ -615,7 +678,11 @@ func FindMultipleRecipesBFSConcurrent(recipesFile, targetElement string, startin
 	variations[0] = make([]ElementRecipe, len(recipes))
 	copy(variations[0], recipes)
 	for i := 1; i < len(variations); i++ {
-		variations[i] = createRecipeVariation(recipes, i)
+		if ctx.Err() != nil {
+			variations = variations[:i]
+			break
+		}
+		variations[i] = createRecipeVariation(recipes, attemptSeed(seed, i))
 	}
 
 	var (
@@ -627,33 +694,42 @@ func FindMultipleRecipesBFSConcurrent(recipesFile, targetElement string, startin
 	)
 
 	// Channel for collecting results from goroutines
-	resultChan := make(chan struct {
-		path    Path
-		visited int
-		varIdx  int
-	}, len(variations)*2)
+	resultChan := make(chan searchHit, len(variations)*2)
 
 	const maxConcurrent = 12
 	sem := make(chan struct{}, maxConcurrent)
 
-	// Collector goroutine
+	accept := func(hit searchHit) {
+		sig := generateSignature(hit.path)
+		if !pathSignatures[sig] && len(allPaths) < maxRecipes && sig != "" {
+			pathSignatures[sig] = true
+			allPaths = append(allPaths, hit.path)
+			totalVisited += hit.visited
+		}
+	}
+
+	// Collector goroutine. With a seed, hits are only filtered once every
+	// worker is done; allPaths stays empty until then, so nothing stops early.
+	var hits []searchHit
+	collected := make(chan struct{})
 	go func() {
-		for result := range resultChan {
+		defer close(collected)
+		for hit := range resultChan {
 			mu.Lock()
-			sig := generateSignature(result.path)
-			if !pathSignatures[sig] && len(allPaths) < maxRecipes && sig != "" {
-				pathSignatures[sig] = true
-				allPaths = append(allPaths, result.path)
-				totalVisited += result.visited
+			if seed != nil {
+				hits = append(hits, hit)
+			} else {
+				accept(hit)
 			}
 			mu.Unlock()
 		}
 	}()
 
-	// Create context for cancellation, but with a longer timeout
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	// Cancelled as soon as we have enough results, or when the caller gives up
+	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
+combos:
 	for comboIdx, combo := range targetRecipes {
 		if comboIdx >= maxRecipes*2 {
 			break
@@ -670,10 +746,14 @@ func FindMultipleRecipesBFSConcurrent(recipesFile, targetElement string, startin
 			continue // Skip if any ingredient has equal or higher tier
 		}
 
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			break combos
+		}
 		wg.Add(1)
-		sem <- struct{}{}
 
-		go func(ingredients [2]string) {
+		go func(ingredients [2]string, comboIdx int) {
 			defer wg.Done()
 			defer func() { <-sem }()
 
@@ -691,7 +771,10 @@ func FindMultipleRecipesBFSConcurrent(recipesFile, targetElement string, startin
 				// Find path for this ingredient
 				var ingPathsForThisIng []Path
 				for _, recipeVariation := range variations {
-					ingPaths, _, iterations := findPathBFS(recipeVariation, startingElements, ing)
+					if ctx.Err() != nil {
+						break
+					}
+					ingPaths, _, iterations := findPathBFS(ctx, recipeVariation, startingElements, ing)
 					totalIteration += iterations
 					if len(ingPaths) > 0 {
 						ingPathsForThisIng = append(ingPathsForThisIng, ingPaths...)
@@ -710,6 +793,10 @@ func FindMultipleRecipesBFSConcurrent(recipesFile, targetElement string, startin
 				var pathCombinations [][]Path
 
 				generatePathCombinations = func(currentIndex int, currentCombination []Path) {
+					if ctx.Err() != nil {
+						return
+					}
+
 					// If we've processed all ingredients, add this combination
 					if currentIndex >= len(allIngPaths) {
 						// Create a deep copy of the combination
@@ -732,6 +819,10 @@ func FindMultipleRecipesBFSConcurrent(recipesFile, targetElement string, startin
 
 				// Create different path variations from the combinations
 				for i, combo := range pathCombinations {
+					if ctx.Err() != nil {
+						break
+					}
+
 					// Create a combined path for this variation
 					var combinedPath Path
 					combinedPath.FinalItem = targetElement
@@ -759,17 +850,14 @@ func FindMultipleRecipesBFSConcurrent(recipesFile, targetElement string, startin
 					combinedPath.Steps = append(combinedPath.Steps, finalStep)
 
 					// Submit this path variation
-					resultChan <- struct {
-						path    Path
-						visited int
-						varIdx  int
-					}{combinedPath, totalIteration, i}
+					resultChan <- searchHit{combinedPath, totalIteration, [2]int{comboIdx, i}}
 				}
 			}
-		}(combo)
+		}(combo, comboIdx)
 	}
 
 	// Launch goroutines for each recipe variation
+variations:
 	for varIdx, recipeVariation := range variations {
 		mu.Lock()
 		if len(allPaths) >= maxRecipes {
@@ -778,83 +866,62 @@ func FindMultipleRecipesBFSConcurrent(recipesFile, targetElement string, startin
 		}
 		mu.Unlock()
 
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			break variations
+		}
 		wg.Add(1)
-		sem <- struct{}{}
 
 		go func(recipes []ElementRecipe, idx int) {
 			defer wg.Done()
 			defer func() { <-sem }()
 
-			// Use channel with timeout to prevent hanging
-			innerChan := make(chan struct {
-				paths   []Path
-				visited int
-			}, 1)
-
-			go func() {
-				select {
-				case <-ctx.Done():
-					return
-				default:
-					paths, _, visited := findPathBFS(recipes, startingElements, targetElement)
-					if len(paths) > 0 {
-						innerChan <- struct {
-							paths   []Path
-							visited int
-						}{paths, visited}
-					}
-				}
-			}()
-
-			// Wait for result with timeout (longer timeout)
-			select {
-			case result := <-innerChan:
-				for _, p := range result.paths {
-					mu.Lock()
-					if len(allPaths) >= maxRecipes {
-						mu.Unlock()
-						break
-					}
-					mu.Unlock()
-
-					resultChan <- struct {
-						path    Path
-						visited int
-						varIdx  int
-					}{p, result.visited, idx}
-				}
-
-				// Cancel if we have enough results
+			paths, _, visited := findPathBFS(ctx, recipes, startingElements, targetElement)
+			for i, p := range paths {
 				mu.Lock()
 				if len(allPaths) >= maxRecipes {
-					cancel()
+					mu.Unlock()
+					break
 				}
 				mu.Unlock()
-			case <-time.After(8 * time.Second): // Longer timeout
-				fmt.Print("Timeout for variation", idx, "after 8 seconds\n")
-				// Timeout, continue with other variations
-				return
-			case <-ctx.Done():
-				return
+
+				// variation hits come after every combo hit
+				resultChan <- searchHit{p, visited, [2]int{len(targetRecipes) + idx, i}}
+			}
+
+			// Cancel if we have enough results
+			mu.Lock()
+			if len(allPaths) >= maxRecipes {
+				cancel()
 			}
+			mu.Unlock()
 		}(recipeVariation, varIdx)
 	}
 
 	wg.Wait()
 	close(resultChan)
+	<-collected
+
+	sortHits(hits)
+	for _, hit := range hits {
+		accept(hit)
+	}
 
 	// Sort paths by number of steps (shortest first)
-	sort.Slice(allPaths, func(i, j int) bool {
+	sort.SliceStable(allPaths, func(i, j int) bool {
 		return len(allPaths[i].Steps) < len(allPaths[j].Steps)
 	})
 
 	duration := time.Since(startTime)
-	return allPaths, totalVisited, duration
+	return allPaths, totalVisited, duration, searchError(ctx, targetElement, len(allPaths))
 }
 
-func shuffleRecipes(elements map[string][][]string, seed int) {
-	rng := rand.New(rand.NewSource(int64(seed)))
-	for elem, recipes := range elements {
+func shuffleRecipes(elements map[string][][]string, seed int64) {
+	rng := rand.New(rand.NewSource(seed))
+	// urut supaya tiap elemen selalu dapat angka acak yang sama
+	for _, elem := range sortedKeys(elements) {
+		recipes := elements[elem]
 		for i := len(recipes) - 1; i > 0; i-- {
 			j := rng.Intn(i + 1)
 			recipes[i], recipes[j] = recipes[j], recipes[i]
@@ -1,9 +1,11 @@
 package main
 
 import (
+	"alchemy/recipe"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"io"
 	"net/http"
 	"os"
 	"regexp"
@@ -34,7 +36,9 @@ func normalizeName(s string) string {
 	return s
 }
 
-func getDoc() (*goquery.Document, error) {
+// fetchPage downloads the elements page from the wiki. The caller closes
+// the returned body.
+func fetchPage() (io.ReadCloser, error) {
 	client := &http.Client{Timeout: 30 * time.Second}
 	req, _ := http.NewRequest("GET", url, nil)
 	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36")
@@ -44,19 +48,92 @@ func getDoc() (*goquery.Document, error) {
 	if err != nil {
 		return nil, err
 	}
-	defer res.Body.Close()
 	if res.StatusCode != 200 {
+		res.Body.Close()
 		return nil, fmt.Errorf("status code: %d", res.StatusCode)
 	}
-	return goquery.NewDocumentFromReader(res.Body)
+	return res.Body, nil
 }
 
-func mainScrap() error {
+// scrapeElements parses the saved HTML copy of the elements page at
+// fromFile, or fetches and parses the live one when fromFile is empty.
+func scrapeElements(fromFile string, job *scrapeJob) ([]ElementRecipe, error) {
+	if fromFile != "" {
+		return parseFile(fromFile, job)
+	}
+	setPhase(job, PhaseFetching)
+	page, err := fetchPage()
+	if err != nil {
+		return nil, err
+	}
+	defer page.Close()
+	return parseElements(page, job)
+}
+
+// mainScrap scrapes the elements page into a new snapshot, and makes it the
+// active dataset if activate is set. With fromFile set it works offline from
+// that file. Progress is reported to job, which may be nil.
+func mainScrap(fromFile string, activate bool, job *scrapeJob) (SnapshotMeta, error) {
 	start := time.Now()
-	doc, err := getDoc()
+	results, err := scrapeElements(fromFile, job)
+	if err != nil {
+		return SnapshotMeta{}, err
+	}
+
+	source := url
+	if fromFile != "" {
+		source = fromFile
+	}
+	meta, err := saveRecipes(results, source, start, activate, job)
+	if err != nil {
+		return SnapshotMeta{}, err
+	}
+
+	fmt.Printf("✅ Selesai dalam %s, total elemen: %d, snapshot %s\n", time.Since(start), len(results), meta.ID)
+	return meta, nil
+}
+
+// scrapeReader is mainScrap for a page that was already read, e.g. one
+// uploaded to the API.
+func scrapeReader(page io.Reader, source string, activate bool, job *scrapeJob) (SnapshotMeta, error) {
+	start := time.Now()
+	results, err := parseElements(page, job)
+	if err != nil {
+		return SnapshotMeta{}, err
+	}
+	return saveRecipes(results, source, start, activate, job)
+}
+
+// parseFile parses a saved HTML copy of the elements page.
+func parseFile(path string, job *scrapeJob) ([]ElementRecipe, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseElements(f, job)
+}
+
+// parseElements reads the HTML of the elements page from r and extracts
+// every element with its tier, image and recipes. It does no network I/O.
+func parseElements(r io.Reader, job *scrapeJob) ([]ElementRecipe, error) {
+	doc, err := goquery.NewDocumentFromReader(r)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
+	results := parseDocument(doc, job)
+
+	// Earth is always added by hand, so look for anything with a recipe
+	for _, r := range results {
+		if len(r.Recipes) > 0 {
+			return results, nil
+		}
+	}
+	return nil, errors.New("no elements found on the page")
+}
+
+func parseDocument(doc *goquery.Document, job *scrapeJob) []ElementRecipe {
+	setPhase(job, PhaseParsingTiers)
 
 	// STEP 2: Complete reset of approach - use raw DOM inspection and build tier map methodically
 	elementTiers := make(map[string]int)
@@ -91,6 +168,7 @@ func mainScrap() error {
 			Tier: tierNum,
 			Elem: s.Parent(), // Get the h2 that contains this span
 		})
+		job.update(func(status *ScrapeStatus) { status.Counts.TierHeadings++ })
 
 		fmt.Printf("Found tier heading %d: %s (id=%s)\n", tierNum, s.Text(), id)
 	})
@@ -275,9 +353,13 @@ func mainScrap() error {
 	for tier, count := range tierCounts {
 		fmt.Printf("Tier %d: %d elements\n", tier, count)
 	}
-	fmt.Println("------------------------------\n")
+	fmt.Println("------------------------------")
+	fmt.Println()
+
+	job.update(func(status *ScrapeStatus) { status.Counts.Tiered = len(elementTiers) })
 
 	// Continue with your existing image extraction logic
+	setPhase(job, PhaseParsingImages)
 	elementImages := make(map[string]string)
 
 	doc.Find(".wikia-gallery-item, .wikia-gallery-caption, .gallery-image-wrapper").Each(func(i int, item *goquery.Selection) {
@@ -355,7 +437,10 @@ func mainScrap() error {
 		}
 	})
 
+	job.update(func(status *ScrapeStatus) { status.Counts.Images = len(elementImages) })
+
 	// Parse recipes
+	setPhase(job, PhaseParsingRecipes)
 	results := []ElementRecipe{}
 
 	doc.Find(".mw-parser-output").Each(func(i int, content *goquery.Selection) {
@@ -427,6 +512,10 @@ func mainScrap() error {
 					ImageURL: imageURL,
 					Tier:     tier,
 				})
+				job.update(func(status *ScrapeStatus) {
+					status.Counts.Elements++
+					status.Counts.Recipes += len(recipes)
+				})
 			}
 		})
 	})
@@ -500,6 +589,10 @@ func mainScrap() error {
 							ImageURL: imageURL,
 							Tier:     tier,
 						})
+						job.update(func(status *ScrapeStatus) {
+							status.Counts.Elements++
+							status.Counts.Recipes += len(recipes)
+						})
 					}
 				}
 			})
@@ -516,18 +609,59 @@ func mainScrap() error {
 	}
 
 	results = append(results, manualBasics...)
+	return results
+}
 
-	f, err := os.Create("recipes.json")
-	if err != nil {
-		log.Fatal(err)
+// saveRecipes validates the scraped elements and stores them as a snapshot,
+// activating it if asked. A dataset with validation errors is not stored, so
+// a bad scrape never replaces a good dataset. The tiers are stored as
+// scraped but validated as the default dataset will use them, so with
+// computed tiers a missed tier heading is no error.
+func saveRecipes(results []ElementRecipe, source string, scrapedAt time.Time, activate bool, job *scrapeJob) (SnapshotMeta, error) {
+	setPhase(job, PhaseValidating)
+	elements := recipe.ApplyTiers(toElementData(results), recipe.DefaultBasicElements, defaultTierSource())
+	report := recipe.Validate(elements)
+	fmt.Printf("🔎 Validasi: %d error, %d warning %v\n", len(report.Errors), len(report.Warnings), report.Summary)
+	for _, issue := range report.Errors {
+		fmt.Printf("  ❌ %s\n", issue.Message)
+	}
+	job.update(func(status *ScrapeStatus) { status.Validation = report.Summary })
+	if err := report.Err(); err != nil {
+		return SnapshotMeta{}, err
 	}
-	defer f.Close()
 
-	enc := json.NewEncoder(f)
-	enc.SetIndent("", "  ")
-	enc.Encode(results)
+	setPhase(job, PhaseWriting)
+	data, err := json.MarshalIndent(results, "", "  ")
+	if err != nil {
+		return SnapshotMeta{}, err
+	}
+	meta := SnapshotMeta{ScrapedAt: scrapedAt.UTC(), Source: source, Elements: len(results)}
+	for _, r := range results {
+		meta.Recipes += len(r.Recipes)
+	}
 
-	fmt.Printf("✅ Selesai dalam %s, total elemen: %d\n", time.Since(start), len(results))
+	meta, err = saveSnapshot(append(data, '\n'), meta)
+	if err != nil {
+		return SnapshotMeta{}, err
+	}
+	if activate {
+		if err := activateSnapshot(meta.ID); err != nil {
+			return SnapshotMeta{}, err
+		}
+		meta.Active = true
+	}
+	return meta, nil
+}
 
-	return err
+// toElementData converts scraped elements to the recipe package's type.
+func toElementData(results []ElementRecipe) []recipe.ElementData {
+	elements := make([]recipe.ElementData, len(results))
+	for i, r := range results {
+		recipes := make([][]string, len(r.Recipes))
+		for j, combo := range r.Recipes {
+			recipes[j] = []string{combo[0], combo[1]}
+		}
+		elements[i] = recipe.ElementData{Element: r.Element, ImageURL: r.ImageURL, Recipes: recipes, Tier: r.Tier}
+	}
+	return elements
 }
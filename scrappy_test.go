@@ -0,0 +1,93 @@
+package main
+
+import (
+	"alchemy/recipe"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata/")
+
+// TestParseElementsGolden parses a saved copy of the wiki page, as the
+// --from-file mode does, and compares the result with the golden output.
+// Run with -update after a deliberate parser change.
+func TestParseElementsGolden(t *testing.T) {
+	const golden = "testdata/elements.golden.json"
+
+	results, err := parseFile("testdata/elements.html", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := json.MarshalIndent(results, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = append(got, '\n')
+
+	if *update {
+		if err := os.WriteFile(golden, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("parsed elements differ from %s (rerun with -update if intended):\n%s", golden, got)
+	}
+}
+
+func TestParseElementsEmptyPage(t *testing.T) {
+	_, err := parseElements(strings.NewReader("<html><body><p>Not found</p></body></html>"), nil)
+	if err == nil {
+		t.Fatal("parsing a page without elements succeeded")
+	}
+}
+
+// TestSaveRecipesMissedTier scrapes an element whose tier heading was missed:
+// fatal when the searches use the scraped tiers, fine when they are computed.
+// Either way the tiers are stored as scraped.
+func TestSaveRecipesMissedTier(t *testing.T) {
+	results := []ElementRecipe{
+		{Element: "Air"}, {Element: "Earth"}, {Element: "Fire"}, {Element: "Water"},
+		{Element: "Mud", Recipes: [][2]string{{"Earth", "Water"}}}, // tier missed
+	}
+
+	for _, source := range []recipe.TierSource{recipe.TierScraped, recipe.TierComputed} {
+		t.Run(string(source), func(t *testing.T) {
+			t.Chdir(t.TempDir())
+			saved := datasets
+			datasets = &datasetRegistry{byName: map[string]*dataset{
+				defaultDataset: newDataset(DatasetConfig{Name: defaultDataset, File: recipesFile, Tiers: source}),
+			}}
+			t.Cleanup(func() { datasets = saved })
+
+			_, err := saveRecipes(results, "test", time.Now(), true, nil)
+			if source == recipe.TierScraped {
+				if !errors.Is(err, recipe.ErrInvalidDataset) {
+					t.Fatalf("err = %v, want %v", err, recipe.ErrInvalidDataset)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			elements, err := readDataset(activeDataset)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, e := range elements {
+				if e.Element == "Mud" && e.Tier != 0 {
+					t.Errorf("Mud stored with tier %d, want the scraped 0", e.Tier)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"alchemy/recipe"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// snapshotDir holds every retained dataset version: <id>.json with the data
+// and <id>.meta.json with its SnapshotMeta. The active version is the one
+// copied to recipesFile.
+const snapshotDir = "snapshots"
+
+// keepSnapshots is how many versions are retained. The active one is always
+// kept, even when it is older.
+const keepSnapshots = 20
+
+// datasetMu serializes everything that writes snapshots or recipesFile.
+var datasetMu sync.Mutex
+
+var (
+	errSnapshotNotFound = errors.New("snapshot not found")
+	errActiveChanged    = errors.New("the active dataset changed since it was read")
+	snapshotIDPattern   = regexp.MustCompile(`^\d{8}T\d{6}Z-[0-9a-f]{12}$`)
+)
+
+// SnapshotMeta describes one dataset version.
+type SnapshotMeta struct {
+	ID        string    `json:"id"`
+	ScrapedAt time.Time `json:"scraped_at"`
+	Source    string    `json:"source"` // wiki URL, HTML file or "upload"
+	Elements  int       `json:"elements"`
+	Recipes   int       `json:"recipes"`
+	SHA256    string    `json:"sha256"`
+	Active    bool      `json:"active"`
+}
+
+func snapshotPath(id string) string {
+	return filepath.Join(snapshotDir, id+".json")
+}
+
+func snapshotMetaPath(id string) string {
+	return filepath.Join(snapshotDir, id+".meta.json")
+}
+
+// saveSnapshot stores data as a new version, filling in the ID and hash of
+// meta. Data identical to a retained version is not stored twice: that
+// version is returned instead.
+func saveSnapshot(data []byte, meta SnapshotMeta) (SnapshotMeta, error) {
+	datasetMu.Lock()
+	defer datasetMu.Unlock()
+	return saveSnapshotLocked(data, meta)
+}
+
+func saveSnapshotLocked(data []byte, meta SnapshotMeta) (SnapshotMeta, error) {
+	sum := sha256.Sum256(data)
+	meta.SHA256 = hex.EncodeToString(sum[:])
+	meta.Active = false
+
+	snapshots, err := listSnapshotsLocked()
+	if err != nil {
+		return SnapshotMeta{}, err
+	}
+	for _, s := range snapshots {
+		if s.SHA256 == meta.SHA256 {
+			return s, nil
+		}
+	}
+
+	meta.ID = meta.ScrapedAt.UTC().Format("20060102T150405Z") + "-" + meta.SHA256[:12]
+	metaData, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return SnapshotMeta{}, err
+	}
+	if err := os.MkdirAll(snapshotDir, 0o755); err != nil {
+		return SnapshotMeta{}, err
+	}
+	// data first, so a listed snapshot always has its data
+	if err := writeFileAtomic(snapshotPath(meta.ID), data); err != nil {
+		return SnapshotMeta{}, err
+	}
+	if err := writeFileAtomic(snapshotMetaPath(meta.ID), append(metaData, '\n')); err != nil {
+		return SnapshotMeta{}, err
+	}
+
+	return meta, pruneSnapshotsLocked()
+}
+
+// listSnapshots returns the retained versions, newest first.
+func listSnapshots() ([]SnapshotMeta, error) {
+	datasetMu.Lock()
+	defer datasetMu.Unlock()
+	return listSnapshotsLocked()
+}
+
+func listSnapshotsLocked() ([]SnapshotMeta, error) {
+	paths, err := filepath.Glob(filepath.Join(snapshotDir, "*.meta.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	active := fileHash(recipesFile)
+	snapshots := []SnapshotMeta{}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var meta SnapshotMeta
+		if err := json.Unmarshal(data, &meta); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		meta.Active = meta.SHA256 == active
+		snapshots = append(snapshots, meta)
+	}
+
+	sort.Slice(snapshots, func(i, j int) bool {
+		if !snapshots[i].ScrapedAt.Equal(snapshots[j].ScrapedAt) {
+			return snapshots[i].ScrapedAt.After(snapshots[j].ScrapedAt)
+		}
+		return snapshots[i].ID > snapshots[j].ID
+	})
+	return snapshots, nil
+}
+
+// findSnapshot returns the metadata of a retained version.
+func findSnapshot(id string) (SnapshotMeta, error) {
+	snapshots, err := listSnapshots()
+	if err != nil {
+		return SnapshotMeta{}, err
+	}
+	for _, s := range snapshots {
+		if s.ID == id {
+			return s, nil
+		}
+	}
+	return SnapshotMeta{}, fmt.Errorf("%w: %s", errSnapshotNotFound, id)
+}
+
+// readSnapshot returns the data of a retained version, checked against its
+// hash.
+func readSnapshot(id string) ([]byte, error) {
+	if !snapshotIDPattern.MatchString(id) {
+		return nil, fmt.Errorf("%w: %s", errSnapshotNotFound, id)
+	}
+	meta, err := findSnapshot(id)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(snapshotPath(id))
+	if err != nil {
+		return nil, err
+	}
+	if sum := sha256.Sum256(data); hex.EncodeToString(sum[:]) != meta.SHA256 {
+		return nil, fmt.Errorf("snapshot %s is corrupt: content does not match its hash", id)
+	}
+	return data, nil
+}
+
+// activeDataset names the active dataset wherever a snapshot ID is accepted.
+const activeDataset = "active"
+
+// readDataset returns the elements of a retained snapshot, or of the active
+// dataset when ref is activeDataset.
+func readDataset(ref string) ([]recipe.ElementData, error) {
+	var (
+		data []byte
+		err  error
+	)
+	if ref == activeDataset {
+		data, err = os.ReadFile(recipesFile)
+	} else {
+		data, err = readSnapshot(ref)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var elements []recipe.ElementData
+	if err := json.Unmarshal(data, &elements); err != nil {
+		return nil, fmt.Errorf("%s: %w", ref, err)
+	}
+	return elements, nil
+}
+
+// activateSnapshot makes a retained version the active dataset by copying
+// it over recipesFile. The server still has to reload it.
+func activateSnapshot(id string) error {
+	return activateSnapshotOver(id, "")
+}
+
+// activateSnapshotOver is activateSnapshot for a version derived from the
+// active dataset whose SHA-256 was base. It fails with errActiveChanged, and
+// leaves recipesFile alone, if another dataset was activated in between. An
+// empty base activates unconditionally.
+func activateSnapshotOver(id, base string) error {
+	data, err := readSnapshot(id)
+	if err != nil {
+		return err
+	}
+
+	datasetMu.Lock()
+	defer datasetMu.Unlock()
+	if base != "" && fileHash(recipesFile) != base {
+		return errActiveChanged
+	}
+	if err := preserveActiveLocked(); err != nil {
+		return err
+	}
+	return writeFileAtomic(recipesFile, data)
+}
+
+// preserveActiveLocked keeps the current recipesFile as a snapshot before it
+// is replaced, in case it was written before snapshots existed.
+func preserveActiveLocked() error {
+	data, err := os.ReadFile(recipesFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(recipesFile)
+	if err != nil {
+		return err
+	}
+
+	var elements []ElementRecipe
+	if err := json.Unmarshal(data, &elements); err != nil {
+		return nil // not a dataset worth keeping
+	}
+	meta := SnapshotMeta{ScrapedAt: info.ModTime().UTC(), Source: recipesFile, Elements: len(elements)}
+	for _, e := range elements {
+		meta.Recipes += len(e.Recipes)
+	}
+	_, err = saveSnapshotLocked(data, meta)
+	return err
+}
+
+// pruneSnapshotsLocked removes the oldest versions beyond keepSnapshots,
+// never the active one.
+func pruneSnapshotsLocked() error {
+	snapshots, err := listSnapshotsLocked()
+	if err != nil {
+		return err
+	}
+
+	kept := 0
+	for _, s := range snapshots {
+		if s.Active || kept < keepSnapshots {
+			kept++
+			continue
+		}
+		for _, path := range []string{snapshotMetaPath(s.ID), snapshotPath(s.ID)} {
+			if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// fileHash returns the hex SHA-256 of a file, or "" if it cannot be read.
+func fileHash(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// writeFileAtomic replaces path with data. The data goes to a temporary
+// file in the same directory that is then renamed over path, so readers see
+// either the old file or the new one, never a partial write.
+func writeFileAtomic(path string, data []byte) error {
+	dir, base := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+	tmp, err := os.CreateTemp(dir, "."+strings.TrimSuffix(base, filepath.Ext(base))+"-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no-op once renamed
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,469 @@
+package main
+
+import (
+	"alchemy/recipe"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Issue codes of problems in the uploaded file itself, found before the
+// dataset can be validated.
+const (
+	IssueSyntax           = "syntax_error"      // not valid JSON or CSV
+	IssueInvalidField     = "invalid_field"     // unknown field, or a value of the wrong type
+	IssueConflictingField = "conflicting_field" // CSV rows of one element disagree on its image or tier
+)
+
+// csvColumns are the columns of an uploaded CSV, one row per recipe. An
+// element without recipes gets a row with empty ingredients. image_url and
+// tier are optional and only need to be on one row of the element.
+var csvColumns = []string{"element", "first", "second", "image_url", "tier"}
+
+// UploadIssue is a problem of an uploaded dataset, at the line of the file it
+// comes from. Line is 0 for problems of the dataset as a whole.
+type UploadIssue struct {
+	recipe.Issue
+	Line   int `json:"line,omitempty"`
+	Column int `json:"column,omitempty"`
+}
+
+// UploadReport is the validation report of an uploaded dataset, with every
+// issue pointing at a line of the file.
+type UploadReport struct {
+	Valid         bool           `json:"valid"`
+	Elements      int            `json:"elements"`
+	ComputedTiers int            `json:"computed_tiers"` // elements that had no tier
+	Errors        []UploadIssue  `json:"errors"`
+	Warnings      []UploadIssue  `json:"warnings"`
+	Summary       map[string]int `json:"summary"`
+}
+
+// uploadedDataset is a parsed upload and where in the file each part of it
+// is. recipeLines is only known for CSV, where each recipe has its own row.
+type uploadedDataset struct {
+	elements    []recipe.ElementData
+	lines       []int   // line of each element
+	recipeLines [][]int // line of each recipe of each element
+	hasTier     []bool
+}
+
+func (u *uploadedDataset) add(e recipe.ElementData, line int, hasTier bool) {
+	u.elements = append(u.elements, e)
+	u.lines = append(u.lines, line)
+	u.recipeLines = append(u.recipeLines, nil)
+	u.hasTier = append(u.hasTier, hasTier)
+}
+
+// parseErr is a problem found while parsing an upload.
+func parseErr(code string, line, column int, element, format string, args ...any) UploadIssue {
+	return UploadIssue{
+		Issue:  recipe.Issue{Severity: recipe.SeverityError, Code: code, Element: element, Message: fmt.Sprintf(format, args...)},
+		Line:   line,
+		Column: column,
+	}
+}
+
+// parseUploadJSON reads a dataset in the recipes.json schema. Decoding stops
+// at the first error, which is reported at its line.
+func parseUploadJSON(data []byte) (*uploadedDataset, []UploadIssue) {
+	// position turns a byte offset into a 1-based line and column
+	position := func(offset int64) (int, int) {
+		offset = min(max(offset, 0), int64(len(data)))
+		before := data[:offset]
+		return bytes.Count(before, []byte("\n")) + 1, int(offset) - bytes.LastIndexByte(before, '\n')
+	}
+	fail := func(err error, start int64, element string) []UploadIssue {
+		var syntaxErr *json.SyntaxError
+		var typeErr *json.UnmarshalTypeError
+		switch {
+		case errors.As(err, &syntaxErr):
+			line, col := position(syntaxErr.Offset)
+			return []UploadIssue{parseErr(IssueSyntax, line, col, element, "%v", err)}
+		case errors.As(err, &typeErr):
+			// unlike syntax errors, counted from the start of the element
+			line, col := position(start + typeErr.Offset)
+			return []UploadIssue{parseErr(IssueInvalidField, line, col, element, "%s has the wrong type: got %s, want %s", typeErr.Field, typeErr.Value, typeErr.Type)}
+		case errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF):
+			line, col := position(int64(len(data)))
+			return []UploadIssue{parseErr(IssueSyntax, line, col, element, "unexpected end of file")}
+		}
+		// unknown fields and the like have no offset of their own
+		line, _ := position(start)
+		return []UploadIssue{parseErr(IssueInvalidField, line, 0, element, "%s", strings.TrimPrefix(err.Error(), "json: "))}
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if tok, err := dec.Token(); err != nil {
+		return nil, fail(err, 0, "")
+	} else if tok != json.Delim('[') {
+		return nil, []UploadIssue{parseErr(IssueSyntax, 1, 0, "", "dataset must be a JSON array of elements")}
+	}
+
+	u := &uploadedDataset{}
+	for dec.More() {
+		// the element starts after the comma and whitespace before it
+		start := dec.InputOffset()
+		for start < int64(len(data)) && strings.IndexByte(" \t\r\n,", data[start]) >= 0 {
+			start++
+		}
+
+		var e struct {
+			Element  string     `json:"element"`
+			ImageURL string     `json:"image_url"`
+			Recipes  [][]string `json:"recipes"`
+			Tier     *int       `json:"tier"`
+		}
+		if err := dec.Decode(&e); err != nil {
+			return nil, fail(err, start, e.Element)
+		}
+
+		line, _ := position(start)
+		elem := recipe.ElementData{Element: e.Element, ImageURL: e.ImageURL, Recipes: e.Recipes}
+		if e.Tier != nil {
+			elem.Tier = *e.Tier
+		}
+		u.add(elem, line, e.Tier != nil)
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, fail(err, dec.InputOffset(), "")
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		line, col := position(dec.InputOffset())
+		return nil, []UploadIssue{parseErr(IssueSyntax, line, col, "", "unexpected data after the dataset")}
+	}
+	return u, nil
+}
+
+// parseUploadCSV reads a dataset with csvColumns, in any order, from a file
+// whose first row names them. All problems of the file are reported.
+func parseUploadCSV(data []byte) (*uploadedDataset, []UploadIssue) {
+	r := csv.NewReader(bytes.NewReader(data))
+	r.TrimLeadingSpace = true
+
+	header, err := r.Read()
+	if err != nil {
+		return nil, []UploadIssue{parseErr(IssueSyntax, 1, 0, "", "reading the header row: %v", err)}
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	var problems []UploadIssue
+	for _, name := range csvColumns[:3] {
+		if _, ok := columns[name]; !ok {
+			problems = append(problems, parseErr(IssueInvalidField, 1, 0, "", "missing column %q (the columns are %s)", name, strings.Join(csvColumns, ", ")))
+		}
+	}
+	if problems != nil {
+		return nil, problems
+	}
+	field := func(record []string, name string) string {
+		if i, ok := columns[name]; ok {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	u := &uploadedDataset{}
+	index := make(map[string]int) // element name -> position in u
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		var parseError *csv.ParseError
+		if errors.As(err, &parseError) {
+			problems = append(problems, parseErr(IssueSyntax, parseError.Line, parseError.Column, "", "%v", parseError.Err))
+			if errors.Is(err, csv.ErrFieldCount) {
+				continue
+			}
+			break
+		}
+		if err != nil {
+			problems = append(problems, parseErr(IssueSyntax, 0, 0, "", "%v", err))
+			break
+		}
+		line, _ := r.FieldPos(0)
+
+		name := field(record, "element")
+		tier, hasTier := 0, false
+		if t := field(record, "tier"); t != "" {
+			n, err := strconv.Atoi(t)
+			if err != nil {
+				_, col := r.FieldPos(columns["tier"])
+				problems = append(problems, parseErr(IssueInvalidField, line, col, name, "tier %q is not a number", t))
+				continue
+			}
+			tier, hasTier = n, true
+		}
+		imageURL := field(record, "image_url")
+
+		i, seen := index[name]
+		if !seen {
+			i = len(u.elements)
+			index[name] = i
+			u.add(recipe.ElementData{Element: name, ImageURL: imageURL, Tier: tier, Recipes: [][]string{}}, line, hasTier)
+		}
+		e := &u.elements[i]
+		if seen {
+			// every row repeats the element, so its image and tier may be on
+			// any of them, but must agree
+			switch {
+			case imageURL != "" && e.ImageURL != "" && imageURL != e.ImageURL:
+				problems = append(problems, parseErr(IssueConflictingField, line, 0, name, "%s has image %q here but %q on line %d", name, imageURL, e.ImageURL, u.lines[i]))
+			case hasTier && u.hasTier[i] && tier != e.Tier:
+				problems = append(problems, parseErr(IssueConflictingField, line, 0, name, "%s has tier %d here but %d on line %d", name, tier, e.Tier, u.lines[i]))
+			}
+			if e.ImageURL == "" {
+				e.ImageURL = imageURL
+			}
+			if hasTier && !u.hasTier[i] {
+				e.Tier, u.hasTier[i] = tier, true
+			}
+		}
+
+		first, second := field(record, "first"), field(record, "second")
+		if first != "" || second != "" {
+			e.Recipes = append(e.Recipes, []string{first, second})
+			u.recipeLines[i] = append(u.recipeLines[i], line)
+		}
+	}
+	if problems != nil {
+		return nil, problems
+	}
+	return u, nil
+}
+
+// computeMissingTiers gives the elements uploaded without a tier their
+// crafting depth from basics, and returns how many it could give one to.
+// Elements that cannot be crafted keep tier 0 and fail validation.
+func (u *uploadedDataset) computeMissingTiers(basics []string) int {
+	var computed map[string]int
+	n := 0
+	for i := range u.elements {
+		if u.hasTier[i] {
+			continue
+		}
+		if computed == nil {
+			computed = recipe.ComputeTiers(u.elements, basics)
+		}
+		if tier, ok := computed[u.elements[i].Element]; ok {
+			u.elements[i].Tier = tier
+			n++
+		}
+	}
+	return n
+}
+
+// validate runs recipe.Validate on the upload and points each issue at the
+// line it comes from.
+func (u *uploadedDataset) validate(basics []string) *UploadReport {
+	computed := u.computeMissingTiers(basics)
+	report := recipe.Validate(u.elements, basics...)
+
+	// elements by name, in file order; names can repeat in a broken upload
+	byName := make(map[string][]int)
+	for i, e := range u.elements {
+		byName[e.Element] = append(byName[e.Element], i)
+	}
+	// empty names and duplicates are reported once per extra occurrence, in
+	// file order
+	next := make(map[string]int)
+
+	locate := func(issue recipe.Issue) UploadIssue {
+		located := UploadIssue{Issue: issue}
+		name := issue.Element
+		indexes := byName[name]
+		if issue.Code == recipe.IssueEmptyName {
+			name, indexes = "", byName[""]
+		}
+		if len(indexes) == 0 {
+			return located
+		}
+
+		i := indexes[0]
+		switch issue.Code {
+		case recipe.IssueEmptyName:
+			i = indexes[min(next[name], len(indexes)-1)]
+			next[name]++
+		case recipe.IssueDuplicateElement:
+			next[name]++
+			i = indexes[min(next[name], len(indexes)-1)]
+		case recipe.IssueMissingTier:
+			if !u.hasTier[i] {
+				located.Message = fmt.Sprintf("%s has no tier, and none can be computed as it cannot be crafted from the basics", name)
+			}
+		}
+		located.Line = u.lines[i]
+
+		// a recipe issue points at the recipe's own row, when known
+		if issue.Recipe != nil && u.recipeLines[i] != nil {
+			for j, r := range u.elements[i].Recipes {
+				if slices.Equal(r, issue.Recipe) {
+					located.Line = u.recipeLines[i][j]
+					if issue.Code != recipe.IssueDuplicateRecipe {
+						break // duplicates point at the last copy
+					}
+				}
+			}
+		}
+		return located
+	}
+
+	out := &UploadReport{
+		Valid:         report.Valid,
+		Elements:      report.Elements,
+		ComputedTiers: computed,
+		Errors:        make([]UploadIssue, 0, len(report.Errors)),
+		Warnings:      make([]UploadIssue, 0, len(report.Warnings)),
+		Summary:       report.Summary,
+	}
+	for _, issue := range report.Errors {
+		out.Errors = append(out.Errors, locate(issue))
+	}
+	for _, issue := range report.Warnings {
+		out.Warnings = append(out.Warnings, locate(issue))
+	}
+	return out
+}
+
+// parseFailure is the report of an upload that could not be parsed at all.
+func parseFailure(problems []UploadIssue) *UploadReport {
+	report := &UploadReport{Errors: problems, Warnings: []UploadIssue{}, Summary: make(map[string]int)}
+	for _, p := range problems {
+		report.Summary[p.Code]++
+	}
+	return report
+}
+
+// uploadDataset handles POST /api/datasets: the body is the dataset, as JSON
+// (application/json) or CSV (text/csv), and the query names it:
+//
+//	name     name of the dataset, required
+//	title    display title
+//	basics   comma-separated starting elements, DefaultBasicElements if empty
+//	tiers    tier source of the dataset, scraped (default) or computed
+//	replace  true to overwrite an uploaded dataset of the same name
+//
+// Invalid uploads are refused with the UploadReport and nothing is stored.
+func uploadDataset(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	config := DatasetConfig{Name: q.Get("name"), Title: q.Get("title"), Tiers: recipe.TierScraped}
+	if config.Name == "" {
+		writeError(w, http.StatusBadRequest, "Missing name")
+		return
+	}
+	if !datasetNamePattern.MatchString(config.Name) {
+		writeError(w, http.StatusBadRequest, "Invalid name: "+errInvalidDatasetID.Error())
+		return
+	}
+	for _, b := range strings.Split(q.Get("basics"), ",") {
+		if b = strings.TrimSpace(b); b != "" {
+			config.Basics = append(config.Basics, b)
+		}
+	}
+	if len(config.Basics) == 0 {
+		config.Basics = recipe.DefaultBasicElements
+	}
+	if t := q.Get("tiers"); t != "" {
+		source, err := recipe.ParseTierSource(t)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		config.Tiers = source
+	}
+	replace := false
+	if v := q.Get("replace"); v != "" {
+		val, err := strconv.ParseBool(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid replace parameter")
+			return
+		}
+		replace = val
+	}
+	// checked again when storing, but no need to validate a doomed upload
+	if config.Name == defaultDataset {
+		writeErrorCode(w, http.StatusConflict, "dataset_exists", errDefaultDataset.Error())
+		return
+	}
+	existing, err := datasets.get(config.Name)
+	switch {
+	case err == nil && !replace:
+		writeErrorCode(w, http.StatusConflict, "dataset_exists", fmt.Sprintf("%v: %s (use replace=true to overwrite it)", errDatasetExists, config.Name))
+		return
+	case err == nil && !existing.config.Uploaded:
+		writeErrorCode(w, http.StatusConflict, "dataset_exists", fmt.Sprintf("%v: %s (only uploaded datasets can be replaced)", errDatasetExists, config.Name))
+		return
+	case err != nil && datasets.uploaded() >= maxUploadedDatasets:
+		writeErrorCode(w, http.StatusConflict, "too_many_datasets", errTooManyDatasets.Error())
+		return
+	}
+
+	parse := parseUploadJSON
+	mediaType, _, _ := strings.Cut(r.Header.Get("Content-Type"), ";")
+	switch strings.TrimSpace(strings.ToLower(mediaType)) {
+	case "application/json", "":
+	case "text/csv":
+		parse = parseUploadCSV
+	default:
+		writeError(w, http.StatusUnsupportedMediaType, "Dataset must be application/json or text/csv")
+		return
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxDatasetUpload))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeErrorCode(w, http.StatusRequestEntityTooLarge, "dataset_too_large", fmt.Sprintf("Datasets are limited to %d bytes", maxDatasetUpload))
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Reading dataset failed: "+err.Error())
+		return
+	}
+
+	upload, problems := parse(data)
+	var report *UploadReport
+	if problems != nil {
+		report = parseFailure(problems)
+	} else {
+		report = upload.validate(config.Basics)
+	}
+	if !report.Valid {
+		writeJSONStatus(w, http.StatusUnprocessableEntity, struct {
+			Error string `json:"error"`
+			Code  string `json:"code"`
+			*UploadReport
+		}{"Invalid dataset, see errors", "invalid_dataset", report})
+		return
+	}
+
+	d, err := datasets.store(config, upload.elements, replace)
+	switch {
+	case errors.Is(err, errDatasetExists), errors.Is(err, errDefaultDataset):
+		writeErrorCode(w, http.StatusConflict, "dataset_exists", err.Error())
+		return
+	case errors.Is(err, errTooManyDatasets):
+		writeErrorCode(w, http.StatusConflict, "too_many_datasets", err.Error())
+		return
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, "Storing dataset failed: "+err.Error())
+		return
+	}
+	log.Printf("Dataset %s uploaded: %d elements, %d warnings", config.Name, report.Elements, len(report.Warnings))
+
+	writeJSONStatus(w, http.StatusCreated, struct {
+		Dataset    DatasetInfo   `json:"dataset"`
+		Validation *UploadReport `json:"validation"`
+	}{d.Info(), report})
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"alchemy/recipe"
+	"testing"
+)
+
+// issueAt is the part of an UploadIssue the tests check.
+type issueAt struct {
+	code string
+	line int
+}
+
+func checkIssues(t *testing.T, got []UploadIssue, want []issueAt) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %d issues, want %d: %+v", len(got), len(want), got)
+	}
+	for i, issue := range got {
+		if issue.Code != want[i].code || issue.Line != want[i].line {
+			t.Errorf("issue %d = %s on line %d (%s), want %s on line %d",
+				i, issue.Code, issue.Line, issue.Message, want[i].code, want[i].line)
+		}
+	}
+}
+
+func TestParseUploadJSONErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want []issueAt
+	}{
+		{
+			name: "missing comma",
+			data: "[\n  {\"element\": \"Air\", \"tier\": 0}\n  {\"element\": \"Fire\", \"tier\": 0}\n]",
+			want: []issueAt{{IssueSyntax, 3}},
+		},
+		{
+			name: "unexpected end",
+			data: "[\n  {\"element\": \"Air\", \"tier\": 0},\n",
+			want: []issueAt{{IssueSyntax, 3}},
+		},
+		{
+			name: "tier is a string",
+			data: "[\n  {\"element\": \"Air\", \"tier\": 0},\n  {\"element\": \"Mud\",\n   \"tier\": \"one\"}\n]",
+			want: []issueAt{{IssueInvalidField, 4}},
+		},
+		{
+			name: "recipes are not pairs of names",
+			data: "[\n  {\"element\": \"Mud\", \"recipes\": [[\"Earth\", 2]]}\n]",
+			want: []issueAt{{IssueInvalidField, 2}},
+		},
+		{
+			name: "unknown field",
+			data: "[\n  {\"element\": \"Air\"},\n  {\"element\": \"Mud\", \"teir\": 1}\n]",
+			want: []issueAt{{IssueInvalidField, 3}},
+		},
+		{
+			name: "not an array",
+			data: `{"element": "Air"}`,
+			want: []issueAt{{IssueSyntax, 1}},
+		},
+		{
+			name: "data after the array",
+			data: "[]\n[]",
+			want: []issueAt{{IssueSyntax, 2}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, problems := parseUploadJSON([]byte(tt.data))
+			if u != nil {
+				t.Fatal("parsing succeeded")
+			}
+			checkIssues(t, problems, tt.want)
+		})
+	}
+}
+
+func TestParseUploadCSVErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want []issueAt
+	}{
+		{
+			name: "missing column",
+			data: "element,first\nAir,\n",
+			want: []issueAt{{IssueInvalidField, 1}},
+		},
+		{
+			name: "too many fields",
+			data: "element,first,second,image_url,tier\nAir,,,,0\nMud,Earth,Water,,1,extra\nSteam,Fire,Water,,1,extra\n",
+			want: []issueAt{{IssueSyntax, 3}, {IssueSyntax, 4}},
+		},
+		{
+			name: "too few fields",
+			data: "element,first,second,image_url,tier\nMud,Earth\n",
+			want: []issueAt{{IssueSyntax, 2}},
+		},
+		{
+			name: "bad tier",
+			data: "element,first,second,image_url,tier\nAir,,,,0\nMud,Earth,Water,,one\n",
+			want: []issueAt{{IssueInvalidField, 3}},
+		},
+		{
+			name: "conflicting tiers",
+			data: "element,first,second,image_url,tier\nMud,Earth,Water,,1\nMud,Earth,Earth,,2\n",
+			want: []issueAt{{IssueConflictingField, 3}},
+		},
+		{
+			name: "conflicting images",
+			data: "element,first,second,image_url,tier\nMud,Earth,Water,a.png,1\nMud,Earth,Earth,,1\nMud,Water,Water,b.png,\n",
+			want: []issueAt{{IssueConflictingField, 4}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, problems := parseUploadCSV([]byte(tt.data))
+			if u != nil {
+				t.Fatal("parsing succeeded")
+			}
+			checkIssues(t, problems, tt.want)
+		})
+	}
+}
+
+// TestUploadReportLines checks that validation issues point at the line of
+// the element they are about, each repeated name at its own line.
+func TestUploadReportLines(t *testing.T) {
+	basics := "  {\"element\": \"Air\", \"tier\": 0},\n  {\"element\": \"Earth\", \"tier\": 0},\n" +
+		"  {\"element\": \"Fire\", \"tier\": 0},\n  {\"element\": \"Water\", \"tier\": 0},\n"
+	tests := []struct {
+		name   string
+		data   string
+		format string
+		want   []issueAt
+	}{
+		{
+			name: "duplicate names in JSON",
+			data: "[\n" + basics +
+				"  {\"element\": \"Mud\", \"tier\": 1, \"recipes\": [[\"Earth\", \"Water\"]]},\n" + // line 6
+				"  {\"element\": \"Mud\", \"tier\": 1, \"recipes\": [[\"Earth\", \"Water\"]]},\n" + // line 7
+				"  {\"element\": \"Mud\", \"tier\": 1, \"recipes\": [[\"Earth\", \"Water\"]]}\n]", // line 8
+			format: "json",
+			want:   []issueAt{{recipe.IssueDuplicateElement, 7}, {recipe.IssueDuplicateElement, 8}},
+		},
+		{
+			name: "empty names in JSON",
+			data: "[\n" + basics +
+				"  {\"element\": \"\", \"tier\": 1},\n" + // line 6
+				"  {\"element\": \"Mud\", \"tier\": 1, \"recipes\": [[\"Earth\", \"Water\"]]},\n" +
+				"  {\"element\": \"\", \"tier\": 1}\n]", // line 8
+			format: "json",
+			want:   []issueAt{{recipe.IssueEmptyName, 6}, {recipe.IssueEmptyName, 8}},
+		},
+		{
+			name: "empty name in CSV",
+			data: "element,first,second,image_url,tier\nAir,,,a.png,0\nEarth,,,a.png,0\nFire,,,a.png,0\nWater,,,a.png,0\n" +
+				"Mud,Earth,Water,a.png,1\n,Earth,Fire,a.png,1\n", // line 7
+			format: "csv",
+			want:   []issueAt{{recipe.IssueEmptyName, 7}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parse := parseUploadJSON
+			if tt.format == "csv" {
+				parse = parseUploadCSV
+			}
+			u, problems := parse([]byte(tt.data))
+			if problems != nil {
+				t.Fatalf("parsing failed: %+v", problems)
+			}
+			report := u.validate(recipe.DefaultBasicElements)
+			if report.Valid {
+				t.Fatal("upload is valid")
+			}
+			checkIssues(t, report.Errors, tt.want)
+		})
+	}
+}